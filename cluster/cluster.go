@@ -0,0 +1,50 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Headers carrying the client and priority class of a forwarded eval. Workers trust them only on
+// requests authenticated with the cluster token.
+const (
+	ClientHeader = "X-Myriag-Client"
+	ClassHeader  = "X-Myriag-Class"
+)
+
+// Registration is sent by workers to the coordinator on start and on every heartbeat.
+type Registration struct {
+	ID        string   `json:"id" validate:"required"`
+	URL       string   `json:"url" validate:"required,url"`
+	Languages []string `json:"languages"`
+	Capacity  int      `json:"capacity" validate:"min=1"`
+}
+
+type originKey struct{}
+
+type origin struct {
+	client string
+	class  string
+}
+
+// WithOrigin returns ctx carrying the client and priority class an eval runs for,
+// the coordinator passes them on to the worker running it.
+func WithOrigin(ctx context.Context, client, class string) context.Context {
+	return context.WithValue(ctx, originKey{}, origin{client: client, class: class})
+}
+
+// setOrigin passes the origin carried by ctx on with req.
+func setOrigin(ctx context.Context, req *http.Request) {
+	if o, ok := ctx.Value(originKey{}).(origin); ok {
+		req.Header.Set(ClientHeader, o.client)
+		req.Header.Set(ClassHeader, o.class)
+	}
+}
+
+// setToken authenticates request with the shared cluster token.
+func setToken(req *http.Request, token string) {
+	if token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	}
+}
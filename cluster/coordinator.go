@@ -0,0 +1,251 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hichuyamichu/myriag/errors"
+	"github.com/hichuyamichu/myriag/eval"
+	"go.uber.org/zap"
+)
+
+type worker struct {
+	Registration
+	inFlight int
+	lastSeen time.Time
+}
+
+// WorkerInfo describes a registered worker.
+type WorkerInfo struct {
+	Registration
+	InFlight int       `json:"inFlight"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// Coordinator routes evals to registered workers with free slots.
+type Coordinator struct {
+	token  string
+	client *http.Client
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	workers map[string]*worker
+}
+
+func NewCoordinator(token string, logger *zap.Logger) *Coordinator {
+	return &Coordinator{
+		token:   token,
+		client:  &http.Client{},
+		logger:  logger,
+		workers: make(map[string]*worker),
+	}
+}
+
+// Register adds a worker or refreshes an already registered one.
+func (c *Coordinator) Register(r Registration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w, ok := c.workers[r.ID]
+	if !ok {
+		c.logger.Info("worker registered", zap.String("worker", r.ID), zap.String("url", r.URL), zap.Strings("languages", r.Languages))
+		w = &worker{}
+		c.workers[r.ID] = w
+	}
+	w.Registration = r
+	w.lastSeen = time.Now()
+}
+
+// Workers lists registered workers.
+func (c *Coordinator) Workers() []WorkerInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res := make([]WorkerInfo, 0, len(c.workers))
+	for _, w := range c.workers {
+		res = append(res, WorkerInfo{Registration: w.Registration, InFlight: w.inFlight, LastSeen: w.lastSeen})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res
+}
+
+// Languages returns languages supported by at least one registered worker.
+func (c *Coordinator) Languages() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	seen := make(map[string]bool)
+	res := make([]string, 0)
+	for _, w := range c.workers {
+		for _, lang := range w.Languages {
+			if !seen[lang] {
+				seen[lang] = true
+				res = append(res, lang)
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// ExpireWithInterval drops workers that did not send a heartbeat within ttl until ctx is done.
+func (c *Coordinator) ExpireWithInterval(ctx context.Context, ttl time.Duration) {
+	const _ errors.Op = "cluster/Coordinator.ExpireWithInterval"
+	c.logger.Info("worker expiry is set", zap.Duration("ttl", ttl))
+
+	ticker := time.NewTicker(ttl)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			c.mu.Lock()
+			for id, w := range c.workers {
+				if time.Since(w.lastSeen) > ttl {
+					delete(c.workers, id)
+					c.logger.Info("worker expired", zap.String("worker", id))
+				}
+			}
+			c.mu.Unlock()
+		}
+	}()
+}
+
+// Capacity returns the number of slots of workers supporting lang.
+func (c *Coordinator) Capacity(lang string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res := 0
+	for _, w := range c.workers {
+		if w.supports(lang) {
+			res += w.Capacity
+		}
+	}
+	return res
+}
+
+// acquire reserves a slot on the worker with the most free slots for lang.
+func (c *Coordinator) acquire(lang string) (*worker, error) {
+	const op errors.Op = "cluster/Coordinator.acquire"
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var best *worker
+	supported := false
+	for _, w := range c.workers {
+		if !w.supports(lang) {
+			continue
+		}
+		supported = true
+		if w.inFlight >= w.Capacity {
+			continue
+		}
+		if best == nil || w.Capacity-w.inFlight > best.Capacity-best.inFlight {
+			best = w
+		}
+	}
+
+	if !supported {
+		return nil, errors.E(errors.LanguageNotFound, op)
+	}
+	if best == nil {
+		return nil, errors.E(errors.Errorf("no worker with free slots"), errors.Unavailable, op)
+	}
+
+	best.inFlight++
+	return best, nil
+}
+
+func (c *Coordinator) release(w *worker) {
+	c.mu.Lock()
+	w.inFlight--
+	c.mu.Unlock()
+}
+
+func (w *worker) supports(lang string) bool {
+	for _, l := range w.Languages {
+		if l == lang {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Coordinator) Eval(ctx context.Context, lang string, code string) (eval.Result, error) {
+	const op errors.Op = "cluster/Coordinator.Eval"
+
+	w, err := c.acquire(lang)
+	if err != nil {
+		return eval.Result{}, errors.E(err, op)
+	}
+	defer c.release(w)
+
+	c.logger.Info("routing eval", zap.String("language", lang), zap.String("worker", w.ID))
+	res, err := c.forward(ctx, w.URL, lang, code)
+	if err != nil {
+		return eval.Result{}, errors.E(err, op)
+	}
+
+	return res, nil
+}
+
+func (c *Coordinator) forward(ctx context.Context, url, lang, code string) (eval.Result, error) {
+	const op errors.Op = "cluster/Coordinator.forward"
+
+	body, err := json.Marshal(map[string]string{"language": lang, "code": code})
+	if err != nil {
+		return eval.Result{}, errors.E(err, errors.Internal, op)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/eval", url), bytes.NewReader(body))
+	if err != nil {
+		return eval.Result{}, errors.E(err, errors.Internal, op)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	setToken(req, c.token)
+	setOrigin(ctx, req)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return eval.Result{}, errors.Done(ctx, op)
+		}
+		return eval.Result{}, errors.E(err, errors.IO, op)
+	}
+	defer resp.Body.Close()
+
+	var payload struct {
+		eval.Result
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return eval.Result{}, errors.E(err, errors.IO, op)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return payload.Result, nil
+	case errors.LanguageNotFound.HTTPStatus():
+		return eval.Result{}, errors.E(errors.LanguageNotFound, op)
+	case errors.EvalTimeout.HTTPStatus():
+		return eval.Result{}, errors.E(errors.Errorf("evaluation timeout"), errors.EvalTimeout, op)
+	case errors.QueueFull.HTTPStatus():
+		return eval.Result{}, errors.E(errors.Str(payload.Message), errors.QueueFull, op)
+	case errors.Unavailable.HTTPStatus():
+		return eval.Result{}, errors.E(errors.Str(payload.Message), errors.Unavailable, op)
+	default:
+		return eval.Result{}, errors.E(errors.Errorf("worker responded with %d: %s", resp.StatusCode, payload.Message), errors.Internal, op)
+	}
+}
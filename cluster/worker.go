@@ -0,0 +1,86 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/hichuyamichu/myriag/errors"
+	"go.uber.org/zap"
+)
+
+// Worker keeps the registration of this process with the coordinator alive.
+type Worker struct {
+	reg Registration
+	// languages is called on every heartbeat so language changes reach the coordinator
+	languages      func() []string
+	coordinatorURL string
+	token          string
+	client         *http.Client
+	logger         *zap.Logger
+}
+
+func NewWorker(reg Registration, languages func() []string, coordinatorURL, token string, logger *zap.Logger) *Worker {
+	return &Worker{
+		reg:            reg,
+		languages:      languages,
+		coordinatorURL: coordinatorURL,
+		token:          token,
+		client:         &http.Client{Timeout: 10 * time.Second},
+		logger:         logger,
+	}
+}
+
+// HeartbeatWithInterval registers the worker and refreshes the registration every interval until ctx is done.
+func (w *Worker) HeartbeatWithInterval(ctx context.Context, interval time.Duration) {
+	const _ errors.Op = "cluster/Worker.HeartbeatWithInterval"
+	w.logger.Info("heartbeat is set", zap.String("coordinator", w.coordinatorURL), zap.Duration("interval", interval))
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := w.register(ctx); err != nil {
+				w.logger.Error("failed to register with coordinator", zap.Error(err))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (w *Worker) register(ctx context.Context) error {
+	const op errors.Op = "cluster/Worker.register"
+
+	reg := w.reg
+	reg.Languages = w.languages()
+	body, err := json.Marshal(reg)
+	if err != nil {
+		return errors.E(err, errors.Internal, op)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/workers", w.coordinatorURL), bytes.NewReader(body))
+	if err != nil {
+		return errors.E(err, errors.Internal, op)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	setToken(req, w.token)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return errors.E(err, errors.IO, op)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.E(errors.Errorf("coordinator responded with %d", resp.StatusCode), errors.IO, op)
+	}
+	return nil
+}
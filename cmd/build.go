@@ -2,19 +2,57 @@ package cmd
 
 import (
 	"context"
+	"fmt"
+	"os"
 
 	"github.com/hichuyamichu/myriag/config"
+	"github.com/hichuyamichu/myriag/docker"
 	"github.com/spf13/cobra"
 )
 
+var buildOpts struct {
+	verbose bool
+	force   bool
+	noCache bool
+	pull    bool
+}
+
 var buildCmd = &cobra.Command{
-	Use:   "build",
+	Use:   "build [languages...]",
 	Short: "Builds required docker containers",
+	Long: `Builds docker images of the given languages, or of all enabled languages when none are given.
+Images whose language directory did not change since the last build are skipped.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		langs := config.Languages()
+		if len(args) > 0 {
+			for _, lang := range args {
+				if !config.IsLangSupported(lang) {
+					return fmt.Errorf("language %q is not enabled", lang)
+				}
+			}
+			langs = args
+		}
+
+		opts := docker.BuildOptions{
+			Force:   buildOpts.force,
+			NoCache: buildOpts.noCache,
+			Pull:    buildOpts.pull,
+		}
+		if buildOpts.verbose {
+			opts.Progress = os.Stdout
+		}
+
 		if config.BuildConcurrently() {
-			return dockerHandler.BuildConcurrently(context.Background(), config.Languages())
+			return dockerHandler.BuildConcurrently(context.Background(), langs, opts)
 		} else {
-			return dockerHandler.Build(context.Background(), config.Languages())
+			return dockerHandler.Build(context.Background(), langs, opts)
 		}
 	},
 }
+
+func init() {
+	buildCmd.Flags().BoolVarP(&buildOpts.verbose, "verbose", "v", false, "print build progress")
+	buildCmd.Flags().BoolVarP(&buildOpts.force, "force", "f", false, "rebuild images even if unchanged")
+	buildCmd.Flags().BoolVar(&buildOpts.noCache, "no-cache", false, "do not use docker layer cache, implies --force")
+	buildCmd.Flags().BoolVar(&buildOpts.pull, "pull", false, "pull newer base images, implies --force")
+}
@@ -1,15 +1,23 @@
 package cmd
 
 import (
+	"time"
+
+	"github.com/hichuyamichu/myriag/docker"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 )
 
+var cleanupOpts docker.CleanupOptions
+
 var cleanupCmd = &cobra.Command{
 	Use:   "cleanup",
 	Short: "Cleans up (kills) active docker containers",
+	Long: `Kills containers of all languages, or of a single one with --language.
+With --idle-for only containers created at least that long ago are killed, as eval activity
+of a running server is not visible to this command.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		cleaned, err := dockerHandler.Cleanup(cmd.Context())
+		cleaned, err := dockerHandler.Cleanup(cmd.Context(), cleanupOpts)
 		if err != nil {
 			return err
 		}
@@ -17,3 +25,8 @@ var cleanupCmd = &cobra.Command{
 		return nil
 	},
 }
+
+func init() {
+	cleanupCmd.Flags().StringVar(&cleanupOpts.Language, "language", "", "only clean up containers of this language")
+	cleanupCmd.Flags().DurationVar(&cleanupOpts.IdleFor, "idle-for", time.Duration(0), "only clean up containers idle for at least this long")
+}
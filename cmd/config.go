@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hichuyamichu/myriag/config"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspects the config",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validates the config and language manifests",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// config is loaded and validated before any command runs
+		fmt.Printf("%s is valid, %d languages enabled\n", configName(), len(config.Languages()))
+		return nil
+	},
+}
+
+// languageConfig is the effective config of a language as printed by config show.
+type languageConfig struct {
+	Image   string        `yaml:"image"`
+	Aliases []string      `yaml:"aliases"`
+	Command []string      `yaml:"command"`
+	Limits  config.Limits `yaml:"limits"`
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show [languages...]",
+	Short: "Prints the effective config of languages",
+	Long: `Prints the effective config of the given languages, or of all enabled languages when none are given.
+Limits are merged from the languages map of the config, language manifests and defaultLanguage.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		langs := config.Languages()
+		if len(args) > 0 {
+			for _, lang := range args {
+				if !config.IsLangSupported(lang) {
+					return fmt.Errorf("language %q is not enabled", lang)
+				}
+			}
+			langs = args
+		}
+
+		res := make(map[string]languageConfig, len(langs))
+		for _, lang := range langs {
+			res[lang] = languageConfig{
+				Image:   config.ImageFor(lang),
+				Aliases: config.AliasesFor(lang),
+				Command: config.CommandFor(lang),
+				Limits:  config.LimitsFor(lang),
+			}
+		}
+
+		return yaml.NewEncoder(os.Stdout).Encode(res)
+	},
+}
+
+func configName() string {
+	if name := config.ConfigFileUsed(); name != "" {
+		return name
+	}
+	return "default config"
+}
+
+func init() {
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configShowCmd)
+}
@@ -1,6 +1,10 @@
 package cmd
 
 import (
+	"fmt"
+
+	"github.com/hichuyamichu/myriag/config"
+	"github.com/hichuyamichu/myriag/detect"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 )
@@ -8,12 +12,24 @@ import (
 var evalCmd = &cobra.Command{
 	Use:   "eval",
 	Short: "Evaluates provided code",
+	Args:  cobra.ExactArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		res, err := dockerHandler.Eval(cmd.Context(), args[0], args[1])
+		lang, code := args[0], args[1]
+		if lang == detect.Auto {
+			detected, body, ok := detect.Language(code)
+			if !ok {
+				return fmt.Errorf("failed to detect language")
+			}
+			lang, code = detected, body
+		} else if resolved, ok := config.ResolveLanguage(lang); ok {
+			lang = resolved
+		}
+
+		res, err := dockerHandler.Eval(cmd.Context(), lang, code)
 		if err != nil {
 			return err
 		}
-		logger.Info("eval complete", zap.String("result", res))
+		logger.Info("eval complete", zap.String("language", lang), zap.String("result", res.Output), zap.Int("attempts", res.Attempts), zap.String("verdict", res.Verdict), zap.Any("usage", res.Usage))
 		return nil
 	},
 }
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/hichuyamichu/myriag/config"
+	"github.com/hichuyamichu/myriag/markdown"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var evalMarkdownCmd = &cobra.Command{
+	Use:   "eval-markdown [file]",
+	Short: "Evaluates fenced code blocks of a Markdown file or stdin",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		in := os.Stdin
+		if len(args) == 1 {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			in = f
+		}
+
+		text, err := ioutil.ReadAll(in)
+		if err != nil {
+			return err
+		}
+
+		maxBlocks := config.MaxMarkdownBlocks()
+		for i, block := range markdown.Blocks(string(text)) {
+			if i >= maxBlocks {
+				logger.Warn("block limit exceeded, skipping remaining blocks", zap.Int("limit", maxBlocks))
+				break
+			}
+
+			lang, ok := config.ResolveLanguage(block.Info)
+			if !ok {
+				logger.Error("language not found", zap.Int("block", i), zap.String("info", block.Info))
+				continue
+			}
+
+			res, err := dockerHandler.Eval(cmd.Context(), lang, block.Code)
+			if err != nil {
+				logger.Error("eval failed", zap.Int("block", i), zap.String("language", lang), zap.Error(err))
+				continue
+			}
+			logger.Info("eval complete", zap.Int("block", i), zap.String("language", lang), zap.String("result", res.Output), zap.Int("attempts", res.Attempts))
+		}
+		return nil
+	},
+}
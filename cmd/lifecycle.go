@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/hichuyamichu/myriag/config"
+	"github.com/hichuyamichu/myriag/docker"
+	"github.com/hichuyamichu/myriag/server"
+	"go.uber.org/zap"
+)
+
+// killTimeout bounds killing owned containers on shutdown.
+const killTimeout = time.Minute
+
+// lifecycle runs the server and background loops, shutting them down in order on SIGINT or SIGTERM.
+type lifecycle struct {
+	// ctx is cancelled once shutdown starts, background loops stop with it
+	ctx    context.Context
+	cancel context.CancelFunc
+	// docker is nil when the backend does not run containers
+	docker *docker.Docker
+}
+
+func newLifecycle() *lifecycle {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &lifecycle{ctx: ctx, cancel: cancel}
+}
+
+// serve runs srv until a shutdown signal and returns an error if the shutdown was not clean.
+func (l *lifecycle) serve(srv *server.Server) error {
+	defer l.cancel()
+
+	addr := fmt.Sprintf("%s:%s", config.Host(), config.Port())
+	logger.Info("starting server", zap.String("addr", addr))
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Start(addr)
+	}()
+
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(done)
+
+	select {
+	case err := <-errc:
+		return err
+	case sig := <-done:
+		logger.Info("shutting down", zap.String("signal", sig.String()), zap.Duration("gracePeriod", config.ShutdownGracePeriod()))
+	}
+
+	clean := l.shutdown(srv)
+	if err := <-errc; err != nil && err != http.ErrServerClosed {
+		logger.Error("server stopped with error", zap.Error(err))
+		clean = false
+	}
+
+	if !clean {
+		return fmt.Errorf("shutdown was not clean")
+	}
+	logger.Info("shutdown complete")
+	return nil
+}
+
+// shutdown stops accepting evals, waits for requests in flight up to the grace period,
+// stops background loops and kills owned containers if configured to.
+func (l *lifecycle) shutdown(srv *server.Server) bool {
+	clean := true
+
+	srv.StopAccepting()
+	ctx, cancel := context.WithTimeout(context.Background(), config.ShutdownGracePeriod())
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Error("requests in flight did not finish within grace period", zap.Error(err))
+		clean = false
+	}
+
+	l.cancel()
+
+	if l.docker != nil && config.KillContainersOnShutdown() {
+		ctx, cancel := context.WithTimeout(context.Background(), killTimeout)
+		defer cancel()
+
+		cleaned, err := l.docker.Cleanup(ctx, docker.CleanupOptions{})
+		if err != nil {
+			logger.Error("failed to kill containers", zap.Error(err))
+			clean = false
+		} else {
+			remaining, err := l.docker.ListContainers(ctx, docker.ListOptions{})
+			if err != nil || len(remaining) > 0 {
+				logger.Error("containers left running", zap.Int("remaining", len(remaining)), zap.Error(err))
+				clean = false
+			}
+		}
+		logger.Info("killed containers", zap.Strings("killed", cleaned))
+	}
+
+	return clean
+}
@@ -2,53 +2,72 @@ package cmd
 
 import (
 	"context"
-	"fmt"
-	"os"
-	"os/signal"
-	"syscall"
-	"time"
 
+	"github.com/hichuyamichu/myriag/cluster"
 	"github.com/hichuyamichu/myriag/config"
+	"github.com/hichuyamichu/myriag/docker"
+	"github.com/hichuyamichu/myriag/fake"
 	"github.com/hichuyamichu/myriag/server"
 	"github.com/spf13/cobra"
-	"go.uber.org/zap"
 )
 
 var listenCmd = &cobra.Command{
 	Use:   "listen",
 	Short: "Starts http server for remote eval requests",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		var err error
-		if config.BuildConcurrently() {
-			err = dockerHandler.BuildConcurrently(context.Background(), config.Languages())
-		} else {
-			err = dockerHandler.Build(context.Background(), config.Languages())
-		}
-		if err != nil {
-			return err
-		}
+		l := newLifecycle()
 
-		if config.PrepareContainers() {
-			err = dockerHandler.SetupContainers(context.Background(), config.Languages())
+		var evaluator server.Evaluator
+		if config.ClusterRole() == "coordinator" {
+			coordinator := cluster.NewCoordinator(config.ClusterToken(), logger)
+			coordinator.ExpireWithInterval(l.ctx, 3*config.HeartbeatInterval())
+			evaluator = coordinator
+		} else {
+			var err error
+			evaluator, err = setupBackend(l)
 			if err != nil {
 				return err
 			}
 		}
 
-		dockerHandler.CleanupWithInterval(config.CleanupInterval())
-		srv := server.New(dockerHandler, logger)
-
-		go func() {
-			done := make(chan os.Signal, 1)
-			signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-			<-done
-			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-			defer cancel()
-			srv.Shutdown(ctx)
-		}()
-
-		addr := fmt.Sprintf("%s:%s", config.Host(), config.Port())
-		logger.Info("starting server", zap.String("addr", addr))
-		return srv.Start(addr)
+		srv := server.New(evaluator, logger)
+		return l.serve(srv)
 	},
 }
+
+// setupBackend prepares the configured evaluation backend, its background loops run until l shuts down.
+func setupBackend(l *lifecycle) (server.Evaluator, error) {
+	if config.Backend() == "fake" {
+		logger.Info("using fake backend")
+		watchConfig(nil)
+		return fake.New(logger), nil
+	}
+
+	var err error
+	if config.BuildConcurrently() {
+		err = dockerHandler.BuildConcurrently(context.Background(), config.Languages(), docker.BuildOptions{})
+	} else {
+		err = dockerHandler.Build(context.Background(), config.Languages(), docker.BuildOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := dockerHandler.Reconcile(context.Background()); err != nil {
+		return nil, err
+	}
+
+	if config.PrepareContainers() {
+		err = dockerHandler.SetupContainers(context.Background(), config.Languages())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	dockerHandler.MonitorHosts(l.ctx, config.HostCheckInterval())
+	dockerHandler.CleanupWithInterval(l.ctx, config.CleanupInterval())
+	dockerHandler.JanitorWithInterval(l.ctx, config.JanitorInterval())
+	watchConfig(dockerHandler)
+	l.docker = dockerHandler
+	return dockerHandler, nil
+}
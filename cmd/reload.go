@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+
+	"github.com/hichuyamichu/myriag/config"
+	"github.com/hichuyamichu/myriag/docker"
+	"go.uber.org/zap"
+)
+
+// reloader applies config changes to the running backend.
+type reloader struct {
+	// docker is nil when the backend does not run containers
+	docker *docker.Docker
+
+	// mu keeps changes of one reload from interleaving with those of the next
+	mu sync.Mutex
+}
+
+// watchConfig reloads config when the config file changes or on SIGHUP.
+func watchConfig(d *docker.Docker) {
+	r := &reloader{docker: d}
+
+	if err := config.Watch(r.reload); err != nil {
+		logger.Error("failed to watch config file", zap.Error(err))
+	}
+
+	go func() {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		for range hup {
+			logger.Info("reloading config on SIGHUP")
+			r.reload()
+		}
+	}()
+}
+
+// reload applies the config file. Languages are compared with the config it replaces, so languages
+// enabled or disabled through the admin API in the meantime are not built or drained again.
+func (r *reloader) reload() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prev, next, err := config.Reload()
+	if err != nil {
+		logger.Error("invalid config, keeping previous one", zap.Error(err))
+		return
+	}
+
+	added, removed, changed := diffLimits(prev.LanguageLimits(), next.LanguageLimits())
+	logger.Info("config reloaded", zap.Strings("added", added), zap.Strings("removed", removed), zap.Strings("changed", changed))
+
+	if r.docker == nil {
+		return
+	}
+
+	ctx := context.Background()
+	if len(added) > 0 {
+		var err error
+		if config.BuildConcurrently() {
+			err = r.docker.BuildConcurrently(ctx, added, docker.BuildOptions{})
+		} else {
+			err = r.docker.Build(ctx, added, docker.BuildOptions{})
+		}
+		if err != nil {
+			logger.Error("failed to build added languages", zap.Error(err))
+		}
+	}
+
+	for _, lang := range removed {
+		if _, err := r.docker.Drain(ctx, lang); err != nil {
+			logger.Error("failed to drain removed language", zap.String("lang", lang), zap.Error(err))
+		}
+	}
+
+	for _, lang := range changed {
+		r.docker.ResizeQueues(lang)
+		if _, err := r.docker.UpdateLimits(ctx, lang); err != nil {
+			logger.Error("failed to update container limits", zap.String("lang", lang), zap.Error(err))
+		}
+	}
+}
+
+// diffLimits compares languages and their limits before and after a reload.
+func diffLimits(old, current map[string]config.Limits) (added, removed, changed []string) {
+	added, removed, changed = make([]string, 0), make([]string, 0), make([]string, 0)
+	for lang, limits := range current {
+		prev, ok := old[lang]
+		if !ok {
+			added = append(added, lang)
+		} else if prev != limits {
+			changed = append(changed, lang)
+		}
+	}
+	for lang := range old {
+		if _, ok := current[lang]; !ok {
+			removed = append(removed, lang)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
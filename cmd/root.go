@@ -44,13 +44,17 @@ var (
 			defer logger.Sync()
 
 			initConfig()
+			cfg, err := config.Load()
+			if err != nil {
+				return err
+			}
+			config.Apply(cfg)
 
-			cli, err := client.NewClientWithOpts(client.FromEnv)
+			hosts, err := newDockerHosts()
 			if err != nil {
 				return err
 			}
-			cli.NegotiateAPIVersion(context.Background())
-			dockerHandler = docker.New(cli, logger)
+			dockerHandler = docker.New(hosts, logger)
 			return nil
 		},
 	}
@@ -67,9 +71,12 @@ func init() {
 	rootCmd.PersistentFlags().StringVarP(&dockerfilesDir, "languages", "l", "", "docker files dir path")
 	rootCmd.AddCommand(listenCmd)
 	rootCmd.AddCommand(evalCmd)
+	rootCmd.AddCommand(evalMarkdownCmd)
 	rootCmd.AddCommand(buildCmd)
 	rootCmd.AddCommand(cleanupCmd)
 	rootCmd.AddCommand(prepareCmd)
+	rootCmd.AddCommand(workerCmd)
+	rootCmd.AddCommand(configCmd)
 }
 
 func initConfig() {
@@ -89,3 +96,26 @@ func initConfig() {
 		viper.Set("languages_path", dockerfilesDir)
 	}
 }
+
+func newDockerHosts() ([]*docker.Host, error) {
+	configured := config.DockerHosts()
+	hosts := make([]*docker.Host, 0, len(configured))
+	for _, h := range configured {
+		opts := []client.Opt{client.FromEnv}
+		if h.Address != "" {
+			opts = append(opts, client.WithHost(h.Address))
+		}
+		if h.TLSCACert != "" || h.TLSCert != "" || h.TLSKey != "" {
+			opts = append(opts, client.WithTLSClientConfig(h.TLSCACert, h.TLSCert, h.TLSKey))
+		}
+
+		cli, err := client.NewClientWithOpts(opts...)
+		if err != nil {
+			return nil, err
+		}
+		cli.NegotiateAPIVersion(context.Background())
+		hosts = append(hosts, docker.NewHost(h.Name, cli, h.Weight))
+	}
+
+	return hosts, nil
+}
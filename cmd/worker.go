@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/hichuyamichu/myriag/cluster"
+	"github.com/hichuyamichu/myriag/config"
+	"github.com/hichuyamichu/myriag/server"
+	"github.com/spf13/cobra"
+)
+
+var workerCmd = &cobra.Command{
+	Use:   "worker",
+	Short: "Starts http server serving evals routed by a coordinator",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if config.CoordinatorURL() == "" {
+			return fmt.Errorf("cluster.coordinatorURL is required to run a worker")
+		}
+		if config.ClusterToken() == "" {
+			return fmt.Errorf("cluster.token is required to run a worker")
+		}
+
+		l := newLifecycle()
+		evaluator, err := setupBackend(l)
+		if err != nil {
+			return err
+		}
+
+		srv := server.New(evaluator, logger)
+		srv.RequireToken(config.ClusterToken())
+
+		reg := cluster.Registration{
+			ID:       config.AdvertiseURL(),
+			URL:      config.AdvertiseURL(),
+			Capacity: config.WorkerCapacity(),
+		}
+		worker := cluster.NewWorker(reg, evaluator.Languages, config.CoordinatorURL(), config.ClusterToken(), logger)
+		worker.HeartbeatWithInterval(l.ctx, config.HeartbeatInterval())
+
+		return l.serve(srv)
+	},
+}
@@ -3,8 +3,11 @@ package config
 import (
 	"fmt"
 	"math/big"
+	"path/filepath"
+	"sort"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
 )
 
@@ -12,13 +15,40 @@ func SetDefaults() {
 	viper.SetDefault("buildConcurrently", false)
 	viper.SetDefault("prepareContainers", false)
 	viper.SetDefault("cleanupInterval", 30)
+	viper.SetDefault("hostCheckInterval", 10)
+	viper.SetDefault("janitorInterval", 60)
 	viper.SetDefault("defaultLanguage.memory", "256mb")
 	viper.SetDefault("defaultLanguage.cpus", 0.25)
 	viper.SetDefault("defaultLanguage.timeout", 20)
 	viper.SetDefault("defaultLanguage.concurrent", 5)
+	viper.SetDefault("defaultLanguage.queueDepth", 20)
 	viper.SetDefault("defaultLanguage.retries", 10)
 	viper.SetDefault("defaultLanguage.outputLimit", "4kb")
+	viper.SetDefault("defaultLanguage.evalMemory", 0)
+	viper.SetDefault("defaultLanguage.cpuTime", 10)
+	viper.SetDefault("defaultLanguage.wallTime", 0)
+	viper.SetDefault("defaultLanguage.processes", 32)
+	viper.SetDefault("defaultLanguage.fileSize", "16mb")
 	viper.SetDefault("languages_path", "./languages")
+	viper.SetDefault("backend", "docker")
+	viper.SetDefault("markdown.maxBlocks", 5)
+	viper.SetDefault("batch.maxItems", 50)
+	viper.SetDefault("batch.concurrent", 10)
+	viper.SetDefault("queue.depth", 200)
+	viper.SetDefault("retry.baseDelay", 100)
+	viper.SetDefault("retry.maxDelay", 2000)
+	viper.SetDefault("scheduler.classes", map[string]int{"interactive": 10, "batch": 1})
+	viper.SetDefault("scheduler.defaultClass", "interactive")
+	viper.SetDefault("scheduler.batchClass", "batch")
+	viper.SetDefault("scheduler.clientHeader", "X-Client-ID")
+	viper.SetDefault("queue.waitCountsTowardsTimeout", true)
+	viper.SetDefault("queue.timeout", 10)
+	viper.SetDefault("queue.retryAfter", 1)
+	viper.SetDefault("cluster.role", "standalone")
+	viper.SetDefault("cluster.capacity", 10)
+	viper.SetDefault("cluster.heartbeat", 5)
+	viper.SetDefault("shutdown.gracePeriod", 10)
+	viper.SetDefault("shutdown.killContainers", false)
 }
 
 func UseConfigFile(path string) {
@@ -31,80 +61,209 @@ func TryFindConfig() {
 	viper.AddConfigPath(".")
 	viper.AddConfigPath("$HOME/.myriag")
 	viper.AddConfigPath("/etc/myriag")
-	viper.WatchConfig()
+}
+
+// Watch calls onChange every time the config file changes. Unlike viper.WatchConfig it does not
+// read the file, viper is not safe for concurrent use, so reading is left to Reload.
+func Watch(onChange func()) error {
+	if viper.ConfigFileUsed() == "" {
+		return nil
+	}
+	file := filepath.Clean(viper.ConfigFileUsed())
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// editors replace the file rather than write it, so its dir is watched
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) == file && event.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+					onChange()
+				}
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+			}
+		}
+	}()
+	return nil
 }
 
 func ReadInConfig() error {
+	mu.Lock()
+	defer mu.Unlock()
 	return viper.ReadInConfig()
 }
 
+// Reload reads the config file and applies it once it is valid, returning the config it replaced
+// and the applied one.
+func Reload() (prev, next *Config, err error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := viper.ReadInConfig(); err != nil {
+		return nil, nil, err
+	}
+	next, err = Load()
+	if err != nil {
+		return nil, nil, err
+	}
+	prev = Current()
+	Apply(next)
+	return prev, next, nil
+}
+
 func ConfigFileUsed() string {
 	return viper.ConfigFileUsed()
 }
 
 func BuildConcurrently() bool {
-	return viper.GetBool("buildConcurrently")
+	return Current().BuildConcurrently
 }
 
 func PrepareContainers() bool {
-	return viper.GetBool("prepareContainers")
+	return Current().PrepareContainers
 }
 
 func CleanupInterval() time.Duration {
-	return time.Minute * time.Duration(viper.GetInt("cleanupInterval"))
+	return Current().CleanupInterval
+}
+
+func HostCheckInterval() time.Duration {
+	return Current().HostCheckInterval
+}
+
+func JanitorInterval() time.Duration {
+	return Current().JanitorInterval
+}
+
+// DockerHost describes a Docker daemon myriag can place containers on.
+type DockerHost struct {
+	Name      string `mapstructure:"name"`
+	Address   string `mapstructure:"address"`
+	TLSCACert string `mapstructure:"tlsCACert"`
+	TLSCert   string `mapstructure:"tlsCert"`
+	TLSKey    string `mapstructure:"tlsKey"`
+	Weight    int    `mapstructure:"weight"`
+}
+
+// DockerHosts returns configured Docker hosts. When none are configured a single
+// host using the environment (DOCKER_HOST etc.) is returned.
+func DockerHosts() []DockerHost {
+	return Current().DockerHosts
+}
+
+func Backend() string {
+	return Current().Backend
+}
+
+func ClusterRole() string {
+	return Current().Cluster.Role
+}
+
+func ClusterToken() string {
+	return Current().Cluster.Token
+}
+
+func CoordinatorURL() string {
+	return Current().Cluster.CoordinatorURL
+}
+
+// AdvertiseURL returns the URL under which a worker is reachable by the coordinator.
+func AdvertiseURL() string {
+	return Current().Cluster.AdvertiseURL
+}
+
+func WorkerCapacity() int {
+	return Current().Cluster.Capacity
+}
+
+func HeartbeatInterval() time.Duration {
+	return Current().Cluster.Heartbeat
+}
+
+// ShutdownGracePeriod is how long in-flight requests are waited for on shutdown.
+func ShutdownGracePeriod() time.Duration {
+	return Current().ShutdownGracePeriod
+}
+
+// KillContainersOnShutdown reports whether owned containers are killed on shutdown.
+func KillContainersOnShutdown() bool {
+	return Current().KillContainersOnShutdown
+}
+
+// AdminToken is the bearer token of the admin API, the API is disabled when empty.
+func AdminToken() string {
+	return Current().AdminToken
+}
+
+// MaxMarkdownBlocks is the maximum number of fenced blocks evaluated per message.
+func MaxMarkdownBlocks() int {
+	return Current().MaxMarkdownBlocks
+}
+
+// MaxBatchItems is the maximum number of evals in a single batch request.
+func MaxBatchItems() int {
+	return Current().MaxBatchItems
+}
+
+// MaxBatchConcurrency is the maximum number of batched evals running at once.
+func MaxBatchConcurrency() int {
+	return Current().MaxBatchConcurrency
 }
 
 func Port() string {
-	return viper.GetString("port")
+	return Current().Port
 }
 
 func Host() string {
-	return viper.GetString("host")
+	return Current().Host
 }
 
 func Languages() []string {
 	res := make([]string, 0)
-	languages := viper.GetStringMap("languages")
-	for language := range languages {
+	for language := range Current().Languages {
 		res = append(res, language)
 	}
+	sort.Strings(res)
 
 	return res
 }
 
 func PathToLanguages() string {
-	return viper.GetString("languages_path")
+	return Current().LanguagesPath
 }
 
-func MaxConcurrentEvlasFor(lang string) int {
-	key := fmt.Sprintf("languages.%s.concurrent", lang)
-	if viper.IsSet(key) {
-		return viper.GetInt(key)
-	} else {
-		return viper.GetInt("defaultLanguage.concurrent")
+// languageFor returns effective config of lang, defaultLanguage when lang is not enabled.
+func languageFor(lang string) *Language {
+	c := Current()
+	if l, ok := c.Languages[lang]; ok {
+		return l
 	}
+	return &c.DefaultLanguage
+}
+
+func MaxConcurrentEvlasFor(lang string) int {
+	return languageFor(lang).Concurrent
 }
 
 func MemoryFor(lang string) int64 {
-	key := fmt.Sprintf("languages.%s.memory", lang)
-	if viper.IsSet(key) {
-		return int64(viper.GetSizeInBytes(key))
-	} else {
-		return int64(viper.GetSizeInBytes("defaultLanguage.memory"))
-	}
+	return languageFor(lang).Memory
 }
 
 func NanoCPUFor(lang string) int64 {
-	key := fmt.Sprintf("languages.%s.cpus", lang)
-	if viper.IsSet(key) {
-		res, _ := ParseCPUs(viper.GetString(key))
-		return res
-		// return int64(10e9 * viper.GetFloat64(key))
-	} else {
-		res, _ := ParseCPUs(viper.GetString("defaultLanguage.cpus"))
-		return res
-		// return int64(10e9 * viper.GetFloat64("defaultLanguage.cpus"))
-	}
+	return languageFor(lang).NanoCPUs
 }
 
 func ParseCPUs(value string) (int64, error) {
@@ -119,41 +278,118 @@ func ParseCPUs(value string) (int64, error) {
 	return nano.Num().Int64(), nil
 }
 
-func RetryCountFor(lang string) int {
-	key := fmt.Sprintf("languages.%s.retries", lang)
-	if viper.IsSet(key) {
-		return viper.GetInt(key)
-	} else {
-		return viper.GetInt("defaultLanguage.retries")
-	}
+// QueueDepthFor is the maximum number of evals of lang waiting for a slot.
+func QueueDepthFor(lang string) int {
+	return languageFor(lang).QueueDepth
+}
+
+// QueueConfig configures admission of evals waiting for a free slot.
+func QueueConfig() Queue {
+	return Current().Queue
+}
+
+// RetryPolicy configures delays between attempts of failed evals.
+func RetryPolicy() Retry {
+	return Current().Retry
 }
 
-func MaxOutputFor(lang string) (size uint) {
-	key := fmt.Sprintf("languages.%s.outputLimit", lang)
-	if viper.IsSet(key) {
-		size = viper.GetSizeInBytes(key)
-	} else {
-		size = viper.GetSizeInBytes("defaultLanguage.outputLimit")
+// SchedulerConfig configures fair scheduling of evals across clients.
+func SchedulerConfig() Scheduler {
+	return Current().Scheduler
+}
+
+// SchedulerClasses maps priority classes to their weights.
+func SchedulerClasses() map[string]int {
+	return Current().Scheduler.Classes
+}
+
+// EvalDeadlineFor is the total time an eval of lang may take, waiting for a slot included.
+func EvalDeadlineFor(lang string) time.Duration {
+	q := Current().Queue
+	if q.WaitCountsTowardsTimeout {
+		return TimeoutFor(lang)
 	}
-	return size
+	return q.Timeout + TimeoutFor(lang)
+}
+
+func RetryCountFor(lang string) int {
+	return languageFor(lang).Retries
+}
+
+func MaxOutputFor(lang string) uint {
+	return languageFor(lang).OutputLimit
 }
 
 func TimeoutFor(lang string) time.Duration {
-	key := fmt.Sprintf("languages.%s.timeout", lang)
-	if viper.IsSet(key) {
-		return time.Second * viper.GetDuration(key)
-	} else {
-		return time.Second * viper.GetDuration("defaultLanguage.timeout")
+	return languageFor(lang).Timeout
+}
+
+// EvalLimits limit a single eval, so evals sharing a container do not starve each other.
+type EvalLimits struct {
+	// Memory is the resident memory of all processes of the eval in bytes.
+	Memory int64
+	// CPUTime is CPU time of all processes of the eval.
+	CPUTime time.Duration
+	// WallTime is how long the program of the eval may run, unlike the timeout it does not cover
+	// waiting for a slot and preparing the container.
+	WallTime  time.Duration
+	Processes int
+	// FileSize is the size of files the eval writes in bytes.
+	FileSize int64
+}
+
+func EvalLimitsFor(lang string) EvalLimits {
+	l := languageFor(lang)
+	return EvalLimits{Memory: l.EvalMemory, CPUTime: l.CPUTime, WallTime: l.WallTime, Processes: l.Processes, FileSize: l.FileSize}
+}
+
+// Limits are the effective limits of a language.
+type Limits struct {
+	Memory      int64   `json:"memory" yaml:"memory"`
+	CPUs        float64 `json:"cpus" yaml:"cpus"`
+	Timeout     float64 `json:"timeout" yaml:"timeout"`
+	Concurrent  int     `json:"concurrent" yaml:"concurrent"`
+	QueueDepth  int     `json:"queueDepth" yaml:"queueDepth"`
+	Retries     int     `json:"retries" yaml:"retries"`
+	OutputLimit uint    `json:"outputLimit" yaml:"outputLimit"`
+	EvalMemory  int64   `json:"evalMemory" yaml:"evalMemory"`
+	CPUTime     float64 `json:"cpuTime" yaml:"cpuTime"`
+	WallTime    float64 `json:"wallTime" yaml:"wallTime"`
+	Processes   int     `json:"processes" yaml:"processes"`
+	FileSize    int64   `json:"fileSize" yaml:"fileSize"`
+}
+
+func LimitsFor(lang string) Limits {
+	return languageFor(lang).limits()
+}
+
+func (l *Language) limits() Limits {
+	return Limits{
+		Memory:      l.Memory,
+		CPUs:        float64(l.NanoCPUs) / 1e9,
+		Timeout:     l.Timeout.Seconds(),
+		Concurrent:  l.Concurrent,
+		QueueDepth:  l.QueueDepth,
+		Retries:     l.Retries,
+		OutputLimit: l.OutputLimit,
+		EvalMemory:  l.EvalMemory,
+		CPUTime:     l.CPUTime.Seconds(),
+		WallTime:    l.WallTime.Seconds(),
+		Processes:   l.Processes,
+		FileSize:    l.FileSize,
 	}
 }
 
-func IsLangSupported(lang string) bool {
-	exists := false
-	for _, supportedLanguage := range Languages() {
-		if supportedLanguage == lang {
-			exists = true
-			break
-		}
+// LanguageLimits returns limits of every language enabled in c.
+func (c *Config) LanguageLimits() map[string]Limits {
+	res := make(map[string]Limits)
+	for name, l := range c.Languages {
+		res[name] = l.limits()
 	}
-	return exists
+	return res
+}
+
+func IsLangSupported(lang string) bool {
+	_, ok := Current().Languages[lang]
+	return ok
 }
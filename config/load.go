@@ -0,0 +1,568 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Config is the effective configuration, parsed and validated by Load.
+type Config struct {
+	BuildConcurrently bool
+	PrepareContainers bool
+	CleanupInterval   time.Duration
+	HostCheckInterval time.Duration
+	JanitorInterval   time.Duration
+	Host              string
+	Port              string
+	LanguagesPath     string
+	Backend           string
+	DockerHosts       []DockerHost
+	Cluster           Cluster
+	AdminToken        string
+	// ShutdownGracePeriod is how long in-flight requests are waited for on shutdown.
+	ShutdownGracePeriod      time.Duration
+	KillContainersOnShutdown bool
+	MaxMarkdownBlocks        int
+	MaxBatchItems            int
+	MaxBatchConcurrency      int
+	Queue                    Queue
+	Scheduler                Scheduler
+	Retry                    Retry
+
+	// DefaultLanguage applies to languages which are not enabled.
+	DefaultLanguage Language
+	Languages       map[string]*Language
+}
+
+// Cluster configures coordinator and workers.
+type Cluster struct {
+	Role           string
+	Token          string
+	CoordinatorURL string
+	AdvertiseURL   string
+	Capacity       int
+	Heartbeat      time.Duration
+}
+
+// Queue configures admission of evals waiting for a free slot.
+type Queue struct {
+	// Depth is the maximum number of evals waiting across all languages.
+	Depth int
+	// WaitCountsTowardsTimeout makes time spent waiting part of the eval timeout,
+	// otherwise waiting is limited by Timeout and the eval timeout starts once a slot is acquired.
+	WaitCountsTowardsTimeout bool
+	Timeout                  time.Duration
+	// RetryAfter is suggested to rejected clients.
+	RetryAfter time.Duration
+}
+
+// Retry configures delays between attempts of failed evals.
+type Retry struct {
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// Scheduler configures fair scheduling of evals across clients.
+type Scheduler struct {
+	// Classes maps priority classes to their weights.
+	Classes map[string]int
+	// DefaultClass is used by /eval and /eval/markdown, BatchClass by /eval/batch.
+	DefaultClass string
+	BatchClass   string
+	// ClientHeader identifies clients, the bearer token or remote address are used without it.
+	ClientHeader string
+}
+
+// Language is the effective configuration of a language, merged from the languages
+// map of the config, the language manifest and defaultLanguage in that order.
+type Language struct {
+	Memory      int64
+	NanoCPUs    int64
+	Timeout     time.Duration
+	Concurrent  int
+	Retries     int
+	OutputLimit uint
+	// QueueDepth is the maximum number of evals of the language waiting for a slot.
+	QueueDepth int
+	// EvalMemory, CPUTime, WallTime, Processes and FileSize limit a single eval within its container.
+	EvalMemory int64
+	CPUTime    time.Duration
+	WallTime   time.Duration
+	Processes  int
+	FileSize   int64
+	Aliases    []string
+	Manifest   *Manifest
+}
+
+type rawConfig struct {
+	BuildConcurrently bool         `mapstructure:"buildConcurrently"`
+	PrepareContainers bool         `mapstructure:"prepareContainers"`
+	CleanupInterval   int          `mapstructure:"cleanupInterval"`
+	HostCheckInterval int          `mapstructure:"hostCheckInterval"`
+	JanitorInterval   int          `mapstructure:"janitorInterval"`
+	Host              string       `mapstructure:"host"`
+	Port              string       `mapstructure:"port"`
+	LanguagesPath     string       `mapstructure:"languages_path"`
+	Backend           string       `mapstructure:"backend"`
+	Hosts             []DockerHost `mapstructure:"hosts"`
+	Cluster           struct {
+		Role           string `mapstructure:"role"`
+		Token          string `mapstructure:"token"`
+		CoordinatorURL string `mapstructure:"coordinatorURL"`
+		AdvertiseURL   string `mapstructure:"advertiseURL"`
+		Capacity       int    `mapstructure:"capacity"`
+		Heartbeat      int    `mapstructure:"heartbeat"`
+	} `mapstructure:"cluster"`
+	Shutdown struct {
+		GracePeriod    int  `mapstructure:"gracePeriod"`
+		KillContainers bool `mapstructure:"killContainers"`
+	} `mapstructure:"shutdown"`
+	Admin struct {
+		Token string `mapstructure:"token"`
+	} `mapstructure:"admin"`
+	Markdown struct {
+		MaxBlocks int `mapstructure:"maxBlocks"`
+	} `mapstructure:"markdown"`
+	Queue struct {
+		Depth                    int  `mapstructure:"depth"`
+		WaitCountsTowardsTimeout bool `mapstructure:"waitCountsTowardsTimeout"`
+		Timeout                  int  `mapstructure:"timeout"`
+		RetryAfter               int  `mapstructure:"retryAfter"`
+	} `mapstructure:"queue"`
+	Retry struct {
+		BaseDelay int `mapstructure:"baseDelay"`
+		MaxDelay  int `mapstructure:"maxDelay"`
+	} `mapstructure:"retry"`
+	Scheduler struct {
+		Classes      map[string]int `mapstructure:"classes"`
+		DefaultClass string         `mapstructure:"defaultClass"`
+		BatchClass   string         `mapstructure:"batchClass"`
+		ClientHeader string         `mapstructure:"clientHeader"`
+	} `mapstructure:"scheduler"`
+	Batch struct {
+		MaxItems   int `mapstructure:"maxItems"`
+		Concurrent int `mapstructure:"concurrent"`
+	} `mapstructure:"batch"`
+}
+
+// ValidationError lists every problem found in the config.
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("invalid config:\n  %s", strings.Join(e, "\n  "))
+}
+
+var current atomic.Value
+
+// Current returns the applied config.
+func Current() *Config {
+	if c, ok := current.Load().(*Config); ok {
+		return c
+	}
+	return &Config{Languages: make(map[string]*Language)}
+}
+
+// Apply makes c the config used by the accessors of this package.
+func Apply(c *Config) {
+	current.Store(c)
+}
+
+// overrides stores languages enabled or disabled at runtime, they take precedence over the config file.
+var overrides sync.Map
+
+// mu serialises reading the config file with loading and applying the config,
+// viper is not safe for concurrent use.
+var mu sync.Mutex
+
+// SetEnabled enables or disables lang without editing the config file. The change
+// is validated and applied immediately and survives config reloads.
+func SetEnabled(lang string, enabled bool) error {
+	if lang == "" || lang != filepath.Base(lang) || strings.HasPrefix(lang, ".") {
+		return ValidationError{fmt.Sprintf("languages.%s: invalid language name", lang)}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	prev, had := overrides.Load(lang)
+	overrides.Store(lang, enabled)
+
+	c, err := Load()
+	if err != nil {
+		if had {
+			overrides.Store(lang, prev)
+		} else {
+			overrides.Delete(lang)
+		}
+		return err
+	}
+	Apply(c)
+	return nil
+}
+
+// Load parses and validates the config read by viper, language manifests included.
+func Load() (*Config, error) {
+	raw := rawConfig{}
+	if err := viper.Unmarshal(&raw); err != nil {
+		return nil, ValidationError{err.Error()}
+	}
+
+	errs := make(ValidationError, 0)
+	c := &Config{
+		BuildConcurrently: raw.BuildConcurrently,
+		PrepareContainers: raw.PrepareContainers,
+		CleanupInterval:   time.Minute * time.Duration(raw.CleanupInterval),
+		HostCheckInterval: time.Second * time.Duration(raw.HostCheckInterval),
+		JanitorInterval:   time.Second * time.Duration(raw.JanitorInterval),
+		Host:              raw.Host,
+		Port:              raw.Port,
+		LanguagesPath:     raw.LanguagesPath,
+		Backend:           raw.Backend,
+		Cluster: Cluster{
+			Role:           raw.Cluster.Role,
+			Token:          raw.Cluster.Token,
+			CoordinatorURL: raw.Cluster.CoordinatorURL,
+			AdvertiseURL:   raw.Cluster.AdvertiseURL,
+			Capacity:       raw.Cluster.Capacity,
+			Heartbeat:      time.Second * time.Duration(raw.Cluster.Heartbeat),
+		},
+		AdminToken:               raw.Admin.Token,
+		ShutdownGracePeriod:      time.Second * time.Duration(raw.Shutdown.GracePeriod),
+		KillContainersOnShutdown: raw.Shutdown.KillContainers,
+		MaxMarkdownBlocks:        raw.Markdown.MaxBlocks,
+		MaxBatchItems:            raw.Batch.MaxItems,
+		MaxBatchConcurrency:      raw.Batch.Concurrent,
+		Queue: Queue{
+			Depth:                    raw.Queue.Depth,
+			WaitCountsTowardsTimeout: raw.Queue.WaitCountsTowardsTimeout,
+			Timeout:                  time.Second * time.Duration(raw.Queue.Timeout),
+			RetryAfter:               time.Second * time.Duration(raw.Queue.RetryAfter),
+		},
+		Retry: Retry{
+			BaseDelay: time.Millisecond * time.Duration(raw.Retry.BaseDelay),
+			MaxDelay:  time.Millisecond * time.Duration(raw.Retry.MaxDelay),
+		},
+		Scheduler: Scheduler{
+			Classes:      raw.Scheduler.Classes,
+			DefaultClass: raw.Scheduler.DefaultClass,
+			BatchClass:   raw.Scheduler.BatchClass,
+			ClientHeader: raw.Scheduler.ClientHeader,
+		},
+		Languages: make(map[string]*Language),
+	}
+
+	if c.Cluster.AdvertiseURL == "" {
+		c.Cluster.AdvertiseURL = fmt.Sprintf("http://%s:%s", c.Host, c.Port)
+	}
+
+	c.DockerHosts = raw.Hosts
+	if len(c.DockerHosts) == 0 {
+		c.DockerHosts = []DockerHost{{Name: "local", Weight: 1}}
+	}
+	for i := range c.DockerHosts {
+		if c.DockerHosts[i].Name == "" {
+			c.DockerHosts[i].Name = fmt.Sprintf("host%d", i)
+		}
+		if c.DockerHosts[i].Weight < 0 {
+			errs = append(errs, fmt.Sprintf("hosts[%d].weight: must not be negative", i))
+		}
+		if c.DockerHosts[i].Weight == 0 {
+			c.DockerHosts[i].Weight = 1
+		}
+	}
+
+	if c.Backend != "docker" && c.Backend != "fake" {
+		errs = append(errs, fmt.Sprintf("backend: unknown backend %q, expected docker or fake", c.Backend))
+	}
+	if c.Cluster.Role != "standalone" && c.Cluster.Role != "coordinator" {
+		errs = append(errs, fmt.Sprintf("cluster.role: unknown role %q, expected standalone or coordinator", c.Cluster.Role))
+	}
+	if c.Cluster.Role == "coordinator" && c.Cluster.Token == "" {
+		// anyone could register a worker and receive evals otherwise
+		errs = append(errs, "cluster.token: required by the coordinator role")
+	}
+	positive(&errs, "cleanupInterval", raw.CleanupInterval)
+	positive(&errs, "hostCheckInterval", raw.HostCheckInterval)
+	positive(&errs, "janitorInterval", raw.JanitorInterval)
+	positive(&errs, "cluster.capacity", c.Cluster.Capacity)
+	positive(&errs, "cluster.heartbeat", raw.Cluster.Heartbeat)
+	positive(&errs, "shutdown.gracePeriod", raw.Shutdown.GracePeriod)
+	positive(&errs, "markdown.maxBlocks", c.MaxMarkdownBlocks)
+	positive(&errs, "batch.maxItems", c.MaxBatchItems)
+	positive(&errs, "batch.concurrent", c.MaxBatchConcurrency)
+	positive(&errs, "queue.depth", c.Queue.Depth)
+	positive(&errs, "retry.baseDelay", raw.Retry.BaseDelay)
+	positive(&errs, "retry.maxDelay", raw.Retry.MaxDelay)
+	for class, weight := range c.Scheduler.Classes {
+		positive(&errs, fmt.Sprintf("scheduler.classes.%s", class), weight)
+	}
+	if _, ok := c.Scheduler.Classes[c.Scheduler.DefaultClass]; !ok {
+		errs = append(errs, fmt.Sprintf("scheduler.defaultClass: unknown class %q", c.Scheduler.DefaultClass))
+	}
+	if _, ok := c.Scheduler.Classes[c.Scheduler.BatchClass]; !ok {
+		errs = append(errs, fmt.Sprintf("scheduler.batchClass: unknown class %q", c.Scheduler.BatchClass))
+	}
+	positive(&errs, "queue.timeout", raw.Queue.Timeout)
+	positive(&errs, "queue.retryAfter", raw.Queue.RetryAfter)
+
+	c.DefaultLanguage = parseLanguage(&errs, "defaultLanguage", func(field string) (interface{}, string) {
+		key := fmt.Sprintf("defaultLanguage.%s", field)
+		return viper.Get(key), key
+	})
+
+	enabled := make(map[string]bool)
+	for name := range viper.GetStringMap("languages") {
+		enabled[name] = true
+	}
+	overrides.Range(func(name, value interface{}) bool {
+		enabled[name.(string)] = value.(bool)
+		return true
+	})
+
+	names := make([]string, 0)
+	for name, ok := range enabled {
+		if ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, err := os.Stat(filepath.Join(c.LanguagesPath, name, "Dockerfile")); err != nil {
+			errs = append(errs, fmt.Sprintf("languages.%s: no Dockerfile in %s", name, filepath.Join(c.LanguagesPath, name)))
+		}
+
+		m, err := loadManifest(c.LanguagesPath, name)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("languages.%s: %s", name, err))
+		}
+
+		lang := parseLanguage(&errs, fmt.Sprintf("languages.%s", name), func(field string) (interface{}, string) {
+			key := fmt.Sprintf("languages.%s.%s", name, field)
+			if viper.IsSet(key) {
+				return viper.Get(key), key
+			}
+			if m != nil {
+				key := fmt.Sprintf("limits.%s", field)
+				if m.v.IsSet(key) {
+					return m.v.Get(key), fmt.Sprintf("%s: %s", filepath.Join(c.LanguagesPath, name, "language.yaml"), key)
+				}
+			}
+			key = fmt.Sprintf("defaultLanguage.%s", field)
+			return viper.Get(key), key
+		})
+
+		lang.Aliases = make([]string, 0)
+		if m != nil {
+			lang.Manifest = &m.Manifest
+			lang.Aliases = append(lang.Aliases, m.Aliases...)
+		}
+		lang.Aliases = append(lang.Aliases, viper.GetStringSlice(fmt.Sprintf("languages.%s.aliases", name))...)
+
+		c.Languages[name] = &lang
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return c, nil
+}
+
+// parseLanguage parses limits of a language, get returns value of a field and key it was found under.
+func parseLanguage(errs *ValidationError, name string, get func(field string) (interface{}, string)) Language {
+	lang := Language{}
+
+	value, key := get("memory")
+	memory, err := parseSize(value)
+	if err == nil && memory <= 0 {
+		err = fmt.Errorf("must be greater than 0")
+	}
+	addError(errs, key, err)
+	lang.Memory = memory
+
+	value, key = get("cpus")
+	cpus, err := ParseCPUs(fmt.Sprint(value))
+	if err == nil && (cpus <= 0 || cpus > 1024e9) {
+		err = fmt.Errorf("must be between 0 and 1024")
+	}
+	addError(errs, key, err)
+	lang.NanoCPUs = cpus
+
+	value, key = get("timeout")
+	timeout, err := parseInt(value)
+	if err == nil && timeout <= 0 {
+		err = fmt.Errorf("must be greater than 0")
+	}
+	addError(errs, key, err)
+	lang.Timeout = time.Second * time.Duration(timeout)
+
+	value, key = get("concurrent")
+	lang.Concurrent, err = parseInt(value)
+	if err == nil && lang.Concurrent <= 0 {
+		err = fmt.Errorf("must be greater than 0")
+	}
+	addError(errs, key, err)
+
+	value, key = get("queueDepth")
+	lang.QueueDepth, err = parseInt(value)
+	if err == nil && lang.QueueDepth < 0 {
+		err = fmt.Errorf("must not be negative")
+	}
+	addError(errs, key, err)
+
+	value, key = get("retries")
+	lang.Retries, err = parseInt(value)
+	if err == nil && lang.Retries < 0 {
+		err = fmt.Errorf("must not be negative")
+	}
+	addError(errs, key, err)
+
+	value, key = get("outputLimit")
+	output, err := parseSize(value)
+	if err == nil && output <= 0 {
+		err = fmt.Errorf("must be greater than 0")
+	}
+	addError(errs, key, err)
+	lang.OutputLimit = uint(output)
+
+	value, key = get("evalMemory")
+	lang.EvalMemory, err = parseSize(value)
+	if err == nil && lang.EvalMemory < 0 {
+		err = fmt.Errorf("must not be negative")
+	}
+	addError(errs, key, err)
+	if lang.EvalMemory == 0 && lang.Concurrent > 0 {
+		// evals running at once share memory of the container evenly
+		lang.EvalMemory = lang.Memory / int64(lang.Concurrent)
+	}
+	if lang.EvalMemory > lang.Memory {
+		// runtimes reserving a lot of memory up front ask for more than their share in manifests,
+		// they get the whole container at most
+		lang.EvalMemory = lang.Memory
+	}
+
+	value, key = get("cpuTime")
+	cpuTime, err := parseInt(value)
+	if err == nil && cpuTime <= 0 {
+		err = fmt.Errorf("must be greater than 0")
+	}
+	addError(errs, key, err)
+	lang.CPUTime = time.Second * time.Duration(cpuTime)
+
+	value, key = get("wallTime")
+	wallTime, err := parseInt(value)
+	if err == nil && wallTime < 0 {
+		err = fmt.Errorf("must not be negative")
+	}
+	addError(errs, key, err)
+	lang.WallTime = time.Second * time.Duration(wallTime)
+	if lang.WallTime == 0 || lang.WallTime > lang.Timeout {
+		// unset, the program may run until the eval times out, which also caps longer wall times
+		lang.WallTime = lang.Timeout
+	}
+
+	value, key = get("processes")
+	lang.Processes, err = parseInt(value)
+	if err == nil && lang.Processes <= 0 {
+		err = fmt.Errorf("must be greater than 0")
+	}
+	addError(errs, key, err)
+
+	value, key = get("fileSize")
+	lang.FileSize, err = parseSize(value)
+	if err == nil && lang.FileSize <= 0 {
+		err = fmt.Errorf("must be greater than 0")
+	}
+	addError(errs, key, err)
+
+	return lang
+}
+
+// addError records err once, fields falling back to defaultLanguage report the same error.
+func addError(errs *ValidationError, key string, err error) {
+	if err == nil {
+		return
+	}
+	msg := fmt.Sprintf("%s: %s", key, err)
+	for _, e := range *errs {
+		if e == msg {
+			return
+		}
+	}
+	*errs = append(*errs, msg)
+}
+
+func positive(errs *ValidationError, key string, value int) {
+	if value <= 0 {
+		*errs = append(*errs, fmt.Sprintf("%s: must be greater than 0", key))
+	}
+}
+
+// parseInt accepts whole numbers written as integers, floats or strings.
+func parseInt(value interface{}) (int, error) {
+	switch v := value.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		if v != float64(int(v)) {
+			return 0, fmt.Errorf("%v is not a whole number", v)
+		}
+		return int(v), nil
+	case string:
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a whole number", v)
+		}
+		return n, nil
+	case nil:
+		return 0, fmt.Errorf("missing value")
+	}
+	return 0, fmt.Errorf("%v is not a whole number", value)
+}
+
+var sizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"gb", 1 << 30},
+	{"mb", 1 << 20},
+	{"kb", 1 << 10},
+	{"b", 1},
+}
+
+// parseSize parses sizes like 256mb, plain numbers are bytes.
+func parseSize(value interface{}) (int64, error) {
+	s, ok := value.(string)
+	if !ok {
+		n, err := parseInt(value)
+		return int64(n), err
+	}
+
+	s = strings.ToLower(strings.TrimSpace(s))
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(s, unit.suffix) {
+			n, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(s, unit.suffix)), 64)
+			if err != nil {
+				break
+			}
+			return int64(n * float64(unit.size)), nil
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q, expected a number followed by b, kb, mb or gb", value)
+	}
+	return n, nil
+}
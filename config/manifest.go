@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Manifest describes a language as declared in languages/<lang>/language.yaml.
+type Manifest struct {
+	Name      string   `mapstructure:"name" json:"name"`
+	Aliases   []string `mapstructure:"aliases" json:"aliases"`
+	Extension string   `mapstructure:"extension" json:"extension"`
+	// File overrides the source file name, defaults to program.<extension>.
+	File    string `mapstructure:"file" json:"file,omitempty"`
+	Version string `mapstructure:"version" json:"versionCommand,omitempty"`
+	Compile string `mapstructure:"compile" json:"compile,omitempty"`
+	// Run is the command running the program, /var/run/run.sh is used when empty.
+	Run string `mapstructure:"run" json:"run,omitempty"`
+	// Stdin pipes the code to the run command instead of writing it to the source file.
+	Stdin  bool           `mapstructure:"stdin" json:"stdin"`
+	Limits ManifestLimits `mapstructure:"limits" json:"limits"`
+}
+
+// ManifestLimits are default limits of a language, overridden by the languages map of the config.
+type ManifestLimits struct {
+	Memory      string `mapstructure:"memory" json:"memory,omitempty"`
+	CPUs        string `mapstructure:"cpus" json:"cpus,omitempty"`
+	Timeout     int    `mapstructure:"timeout" json:"timeout,omitempty"`
+	Concurrent  int    `mapstructure:"concurrent" json:"concurrent,omitempty"`
+	QueueDepth  int    `mapstructure:"queueDepth" json:"queueDepth,omitempty"`
+	Retries     int    `mapstructure:"retries" json:"retries,omitempty"`
+	OutputLimit string `mapstructure:"outputLimit" json:"outputLimit,omitempty"`
+	EvalMemory  string `mapstructure:"evalMemory" json:"evalMemory,omitempty"`
+	CPUTime     int    `mapstructure:"cpuTime" json:"cpuTime,omitempty"`
+	WallTime    int    `mapstructure:"wallTime" json:"wallTime,omitempty"`
+	Processes   int    `mapstructure:"processes" json:"processes,omitempty"`
+	FileSize    string `mapstructure:"fileSize" json:"fileSize,omitempty"`
+}
+
+// SourceFile returns name of the file the code is written to.
+func (m *Manifest) SourceFile() string {
+	if m.File != "" {
+		return m.File
+	}
+	return fmt.Sprintf("program.%s", m.Extension)
+}
+
+type manifest struct {
+	Manifest
+	v *viper.Viper
+}
+
+func loadManifest(languagesPath, lang string) (*manifest, error) {
+	path := filepath.Join(languagesPath, lang, "language.yaml")
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("reading manifest: %w", err)
+	}
+
+	m := &manifest{v: v}
+	if err := v.Unmarshal(&m.Manifest); err != nil {
+		return nil, fmt.Errorf("parsing manifest: %w", err)
+	}
+	if m.Name == "" {
+		m.Name = lang
+	}
+	if m.Stdin && m.Compile != "" {
+		return nil, fmt.Errorf("stdin: can not be combined with compile, which reads the source file")
+	}
+	if m.Aliases == nil {
+		m.Aliases = make([]string, 0)
+	}
+
+	return m, nil
+}
+
+// ManifestFor returns manifest of lang or nil if the language does not have one.
+func ManifestFor(lang string) *Manifest {
+	if l, ok := Current().Languages[lang]; ok {
+		return l.Manifest
+	}
+	return nil
+}
+
+// ImageFor returns name of the docker image of lang.
+func ImageFor(lang string) string {
+	return fmt.Sprintf("myriag_%s", lang)
+}
+
+// CommandFor returns the command evaluating code read from stdin.
+func CommandFor(lang string) []string {
+	m := ManifestFor(lang)
+	if m == nil || m.Run == "" {
+		return []string{"/bin/sh", "/var/run/run.sh"}
+	}
+	if m.Stdin {
+		return []string{"/bin/sh", "-c", m.Run}
+	}
+
+	script := fmt.Sprintf("cat > %s\n", m.SourceFile())
+	if m.Compile != "" {
+		script += fmt.Sprintf("%s && ", m.Compile)
+	}
+	script += m.Run
+	return []string{"/bin/sh", "-c", script}
+}
+
+// AliasesFor returns aliases of lang declared in its manifest and in the languages map of the config.
+func AliasesFor(lang string) []string {
+	if l, ok := Current().Languages[lang]; ok {
+		return l.Aliases
+	}
+	return make([]string, 0)
+}
+
+// ResolveLanguage maps a language name or one of its aliases to the enabled language, ignoring case.
+func ResolveLanguage(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	langs := Languages()
+	for _, lang := range langs {
+		if lang == name {
+			return lang, true
+		}
+	}
+
+	for _, lang := range langs {
+		for _, alias := range AliasesFor(lang) {
+			if strings.ToLower(alias) == name {
+				return lang, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,151 @@
+package detect
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/hichuyamichu/myriag/config"
+	"github.com/hichuyamichu/myriag/markdown"
+)
+
+// Auto is the language name requesting detection.
+const Auto = "auto"
+
+type hint struct {
+	lang   string
+	weight int
+	re     *regexp.Regexp
+}
+
+// hints are weighted patterns characteristic for a language.
+var hints = []hint{
+	{"go", 5, regexp.MustCompile(`(?m)^package\s+main\b`)},
+	{"go", 3, regexp.MustCompile(`\bfunc\s+main\s*\(\s*\)`)},
+	{"go", 3, regexp.MustCompile(`\bfmt\.Print`)},
+	{"go", 2, regexp.MustCompile(`:=`)},
+	{"rust", 5, regexp.MustCompile(`\bfn\s+main\s*\(\s*\)`)},
+	{"rust", 4, regexp.MustCompile(`\bprintln!\s*\(`)},
+	{"rust", 2, regexp.MustCompile(`\blet\s+mut\b`)},
+	{"c", 3, regexp.MustCompile(`(?m)^\s*#include\s*<(stdio|stdlib|string)\.h>`)},
+	{"c", 2, regexp.MustCompile(`\bprintf\s*\(`)},
+	{"cpp", 4, regexp.MustCompile(`(?m)^\s*#include\s*<(iostream|vector|string|algorithm|map)>`)},
+	{"cpp", 4, regexp.MustCompile(`\bstd::`)},
+	{"cpp", 3, regexp.MustCompile(`\bcout\s*<<`)},
+	{"java", 5, regexp.MustCompile(`\bpublic\s+static\s+void\s+main\s*\(`)},
+	{"java", 4, regexp.MustCompile(`\bSystem\.out\.print`)},
+	{"csharp", 4, regexp.MustCompile(`\bConsole\.Write(Line)?\s*\(`)},
+	{"csharp", 3, regexp.MustCompile(`(?m)^\s*using\s+System\s*;`)},
+	{"fsharp", 4, regexp.MustCompile(`\bprintfn\b`)},
+	{"python", 3, regexp.MustCompile(`(?m)^\s*def\s+\w+\s*\(.*\)\s*:`)},
+	{"python", 3, regexp.MustCompile(`(?m)^\s*(from\s+\w+\s+)?import\s+\w+\s*$`)},
+	{"python", 2, regexp.MustCompile(`(?m)^\s*print\s*\(`)},
+	{"python", 2, regexp.MustCompile(`(?m)^\s*(if|for|while|elif|else)\b.*:\s*$`)},
+	{"javascript", 4, regexp.MustCompile(`\bconsole\.log\s*\(`)},
+	{"javascript", 2, regexp.MustCompile(`\b(const|let)\s+\w+\s*=`)},
+	{"javascript", 2, regexp.MustCompile(`=>`)},
+	{"typescript", 4, regexp.MustCompile(`\b(const|let|function)\s+\w+\s*(\(.*\))?\s*:\s*(string|number|boolean|void)\b`)},
+	{"typescript", 3, regexp.MustCompile(`(?m)^\s*(interface|type)\s+\w+\s*(=|\{)`)},
+	{"ruby", 4, regexp.MustCompile(`(?m)^\s*puts\b`)},
+	{"ruby", 2, regexp.MustCompile(`(?m)^\s*end\s*$`)},
+	{"php", 6, regexp.MustCompile(`<\?php`)},
+	{"elixir", 5, regexp.MustCompile(`\bdefmodule\b`)},
+	{"elixir", 4, regexp.MustCompile(`\bIO\.puts\b`)},
+	{"erlang", 5, regexp.MustCompile(`(?m)^-module\(`)},
+	{"erlang", 4, regexp.MustCompile(`\bio:format\(`)},
+	{"haskell", 5, regexp.MustCompile(`(?m)^main\s*=`)},
+	{"haskell", 4, regexp.MustCompile(`\bputStrLn\b`)},
+	{"haskell", 3, regexp.MustCompile(`(?m)^import\s+(qualified\s+)?Data\.`)},
+	{"lua", 3, regexp.MustCompile(`(?m)^\s*local\s+\w+\s*=`)},
+	{"lua", 2, regexp.MustCompile(`(?m)\bthen\s*$`)},
+	{"perl", 4, regexp.MustCompile(`(?m)^\s*use\s+(strict|warnings)\s*;`)},
+	{"perl", 3, regexp.MustCompile(`\bmy\s+[$@%]\w+`)},
+	{"bash", 3, regexp.MustCompile(`(?m)^\s*echo\s`)},
+	{"bash", 2, regexp.MustCompile(`(?m)^\s*(fi|done|esac)\s*$`)},
+	{"clojure", 4, regexp.MustCompile(`\((defn|println|ns)\s`)},
+	{"racket", 6, regexp.MustCompile(`(?m)^#lang\s`)},
+	{"julia", 3, regexp.MustCompile(`\bprintln\s*\(`)},
+	{"nim", 4, regexp.MustCompile(`\becho\s+"`)},
+	{"ocaml", 4, regexp.MustCompile(`\bprint_(string|endline|int)\b`)},
+	{"ocaml", 3, regexp.MustCompile(`(?m)^let\s+\(\)\s*=`)},
+	{"pascal", 5, regexp.MustCompile(`(?im)^\s*program\s+\w+\s*;`)},
+	{"pascal", 4, regexp.MustCompile(`(?i)\bwriteln\s*\(`)},
+	{"prolog", 4, regexp.MustCompile(`:-\s*initialization`)},
+	{"r", 4, regexp.MustCompile(`<-\s*(c|function|data\.frame)\s*\(`)},
+	{"r", 3, regexp.MustCompile(`\bcat\s*\(`)},
+	{"brainfuck", 5, regexp.MustCompile(`^[\s+\-<>\[\].,]+$`)},
+	{"apl", 5, regexp.MustCompile(`[⍳⍴⌽⍉∊⎕←]`)},
+	{"idris", 4, regexp.MustCompile(`(?m)^main\s*:\s*IO\s*\(\)`)},
+}
+
+// Language guesses language of code using shebang, Markdown fence info string and
+// heuristics. Only enabled languages are considered. Returns the language and the
+// code with the Markdown fence stripped.
+func Language(code string) (string, string, bool) {
+	if block, ok := markdown.Single(code); ok {
+		if lang, ok := config.ResolveLanguage(block.Info); ok {
+			return lang, block.Code, true
+		}
+		code = block.Code
+	}
+
+	if lang, ok := shebang(code); ok {
+		return lang, code, true
+	}
+
+	if lang, ok := guess(code); ok {
+		return lang, code, true
+	}
+	return "", code, false
+}
+
+// shebang resolves interpreter named in the first line of code.
+func shebang(code string) (string, bool) {
+	if !strings.HasPrefix(code, "#!") {
+		return "", false
+	}
+
+	line := code[2:]
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", false
+	}
+
+	interpreter := path.Base(fields[0])
+	if interpreter == "env" {
+		for _, f := range fields[1:] {
+			if !strings.HasPrefix(f, "-") {
+				interpreter = f
+				break
+			}
+		}
+	}
+
+	if lang, ok := config.ResolveLanguage(interpreter); ok {
+		return lang, true
+	}
+	// python3.8, ruby2.7 etc.
+	return config.ResolveLanguage(strings.TrimRight(interpreter, "0123456789."))
+}
+
+// guess scores code against hints of enabled languages.
+func guess(code string) (string, bool) {
+	scores := make(map[string]int)
+	for _, h := range hints {
+		if config.IsLangSupported(h.lang) && h.re.MatchString(code) {
+			scores[h.lang] += h.weight
+		}
+	}
+
+	best, bestScore := "", 0
+	for _, lang := range config.Languages() {
+		if scores[lang] > bestScore {
+			best, bestScore = lang, scores[lang]
+		}
+	}
+	return best, bestScore > 0
+}
@@ -4,6 +4,9 @@ import (
 	"archive/tar"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -12,22 +15,144 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/hichuyamichu/myriag/config"
 	"github.com/hichuyamichu/myriag/errors"
 )
 
-func (d *Docker) build(ctx context.Context, lang string) error {
-	const op errors.Op = "docker/Docker.build"
+// hashLabel is the image label storing the hash of the language directory the image was built from.
+const hashLabel = "myriag.hash"
+
+// BuildOptions controls how images are built.
+type BuildOptions struct {
+	// Progress receives build output, when nil the output is logged at debug level.
+	Progress io.Writer
+	// Force rebuilds images even if the language directory did not change.
+	Force bool
+	// NoCache disables docker layer cache, implies Force.
+	NoCache bool
+	// Pull pulls newer versions of base images, implies Force.
+	Pull bool
+}
+
+// BuildError is returned when the docker daemon reports a failed build step.
+type BuildError struct {
+	Lang    string
+	Host    string
+	Code    int
+	Message string
+}
+
+func (e *BuildError) Error() string {
+	return fmt.Sprintf("building %s on %s: %s", e.Lang, e.Host, e.Message)
+}
 
-	imageName := fmt.Sprintf("myriag_%s", lang)
-	d.logger.Debug("building image", zap.String("image", imageName))
+func (d *Docker) build(ctx context.Context, h *Host, lang string, opts BuildOptions) error {
+	const op errors.Op = "docker/Docker.build"
 
+	imageName := config.ImageFor(lang)
 	langDir := config.PathToLanguages()
 	source := fmt.Sprintf("%s/%s", langDir, lang)
 
+	hash, err := hashDir(source)
+	if err != nil {
+		return errors.E(err, errors.IO, op)
+	}
+
+	if !opts.Force && !opts.NoCache && !opts.Pull {
+		img, _, err := h.cli.ImageInspectWithRaw(ctx, imageName)
+		if err == nil && img.Config != nil && img.Config.Labels[hashLabel] == hash {
+			d.logger.Debug("image up to date", zap.String("host", h.Name), zap.String("image", imageName), zap.String("hash", hash))
+			d.storeVersion(ctx, h, lang)
+			return nil
+		}
+	}
+
+	d.logger.Debug("building image", zap.String("host", h.Name), zap.String("image", imageName), zap.String("hash", hash))
+
+	buffer, err := tarDir(source)
+	if err != nil {
+		return errors.E(err, errors.IO, op)
+	}
+
+	iresp, err := h.cli.ImageBuild(ctx, buffer, types.ImageBuildOptions{
+		Tags:       []string{imageName},
+		Remove:     true,
+		NoCache:    opts.NoCache,
+		PullParent: opts.Pull,
+		Labels:     map[string]string{hashLabel: hash},
+	})
+	if err != nil {
+		d.checkHost(h, err)
+		return errors.E(err, op)
+	}
+
+	// ImageBuild returns immediately so we block until the stream is over
+	err = d.readBuildOutput(iresp.Body, h, lang, opts)
+	if err != nil {
+		iresp.Body.Close()
+		return errors.E(err, op)
+	}
+
+	err = iresp.Body.Close()
+	if err != nil {
+		return errors.E(err, op)
+	}
+
+	_, _, err = h.cli.ImageInspectWithRaw(ctx, imageName)
+	if err != nil {
+		return errors.E(err, op)
+	}
+
+	d.logger.Debug("build complete", zap.String("host", h.Name), zap.String("image", imageName))
+	d.storeVersion(ctx, h, lang)
+	return nil
+}
+
+// storeVersion captures language version, failures are logged as they do not affect the build.
+func (d *Docker) storeVersion(ctx context.Context, h *Host, lang string) {
+	if err := d.captureVersion(ctx, h, lang); err != nil {
+		d.logger.Error("failed to capture language version", zap.String("host", h.Name), zap.String("lang", lang), zap.Error(err))
+	}
+}
+
+// hashDir hashes relative paths and contents of every file under source.
+func hashDir(source string) (string, error) {
+	hash := sha256.New()
+	err := filepath.Walk(source, func(file string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(source, file)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(hash, "%s\x00%d\x00", filepath.ToSlash(rel), fi.Mode())
+
+		data, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer data.Close()
+
+		_, err = io.Copy(hash, data)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// tarDir packs source into a tar archive used as docker build context.
+func tarDir(source string) (*bytes.Buffer, error) {
 	buffer := new(bytes.Buffer)
 	tarfileWriter := tar.NewWriter(buffer)
-	defer tarfileWriter.Close()
 
 	err := filepath.Walk(source, func(file string, fi os.FileInfo, err error) error {
 		if err != nil {
@@ -42,6 +167,12 @@ func (d *Docker) build(ctx context.Context, lang string) error {
 			return err
 		}
 
+		rel, err := filepath.Rel(source, file)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+
 		if err := tarfileWriter.WriteHeader(header); err != nil {
 			return err
 		}
@@ -50,6 +181,7 @@ func (d *Docker) build(ctx context.Context, lang string) error {
 		if err != nil {
 			return err
 		}
+		defer data.Close()
 
 		if _, err = io.Copy(tarfileWriter, data); err != nil {
 			return err
@@ -58,37 +190,45 @@ func (d *Docker) build(ctx context.Context, lang string) error {
 		return nil
 	})
 	if err != nil {
-		return errors.E(err, op)
+		return nil, err
 	}
 
-	iresp, err := d.cli.ImageBuild(ctx, buffer, types.ImageBuildOptions{
-		Tags:       []string{imageName},
-		Remove:     true,
-		PullParent: true,
-	})
-	if err != nil {
-		return errors.E(err, op)
+	if err := tarfileWriter.Close(); err != nil {
+		return nil, err
 	}
+	return buffer, nil
+}
 
-	// ImageBuild returns immediately so we block until the stream is over
-	b := make([]byte, 4)
+// readBuildOutput decodes the build message stream, forwarding progress and
+// returning a *BuildError if any step failed.
+func (d *Docker) readBuildOutput(body io.Reader, h *Host, lang string, opts BuildOptions) error {
+	const op errors.Op = "docker/Docker.readBuildOutput"
+
+	dec := json.NewDecoder(body)
 	for {
-		_, err = iresp.Body.Read(b)
-		if err == io.EOF {
-			break
+		var msg jsonmessage.JSONMessage
+		if err := dec.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return errors.E(err, errors.IO, op)
 		}
-	}
 
-	err = iresp.Body.Close()
-	if err != nil {
-		return errors.E(err, op)
-	}
+		if msg.Error != nil {
+			return errors.E(&BuildError{Lang: lang, Host: h.Name, Code: msg.Error.Code, Message: msg.Error.Message}, errors.BuildFailed, op)
+		}
+		if msg.ErrorMessage != "" {
+			return errors.E(&BuildError{Lang: lang, Host: h.Name, Message: msg.ErrorMessage}, errors.BuildFailed, op)
+		}
 
-	_, _, err = d.cli.ImageInspectWithRaw(ctx, imageName)
-	if err != nil {
-		return errors.E(err, op)
+		if opts.Progress != nil {
+			if err := msg.Display(opts.Progress, false); err != nil {
+				return errors.E(err, errors.IO, op)
+			}
+		} else if msg.Stream != "" {
+			d.logger.Debug("build output", zap.String("host", h.Name), zap.String("lang", lang), zap.String("stream", msg.Stream))
+		} else if msg.Status != "" {
+			d.logger.Debug("build status", zap.String("host", h.Name), zap.String("lang", lang), zap.String("status", msg.Status), zap.String("id", msg.ID))
+		}
 	}
-
-	d.logger.Debug("build complete", zap.String("image", imageName))
-	return nil
 }
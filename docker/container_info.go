@@ -0,0 +1,139 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/hichuyamichu/myriag/errors"
+	"go.uber.org/zap"
+)
+
+// ListOptions filters and extends container listing.
+type ListOptions struct {
+	// Language limits listing to containers of a single language when not empty.
+	Language string
+	// Stats adds live resource usage, which takes a round trip to the host per container.
+	Stats bool
+}
+
+// ContainerInfo is a container together with its eval activity.
+type ContainerInfo struct {
+	Container
+	// Age is the number of seconds since the container was created.
+	Age      float64         `json:"age"`
+	Served   int64           `json:"served"`
+	InFlight int             `json:"inFlight"`
+	Waiting  int             `json:"waiting"`
+	Draining bool            `json:"draining"`
+	Stats    *ContainerStats `json:"stats,omitempty"`
+}
+
+// ContainerStats is live resource usage of a container.
+type ContainerStats struct {
+	CPUPercent  float64 `json:"cpuPercent"`
+	MemoryUsage uint64  `json:"memoryUsage"`
+	MemoryLimit uint64  `json:"memoryLimit"`
+	PIDs        uint64  `json:"pids"`
+}
+
+func (d *Docker) ListContainers(ctx context.Context, opts ListOptions) ([]ContainerInfo, error) {
+	const op errors.Op = "docker/Docker.ListContainers"
+
+	containers, err := d.listContainers(ctx)
+	if err != nil {
+		return nil, errors.E(err, op)
+	}
+
+	res := make([]ContainerInfo, 0, len(containers))
+	for _, cont := range containers {
+		if opts.Language != "" && cont.Language != opts.Language {
+			continue
+		}
+
+		info := ContainerInfo{
+			Container: cont,
+			Age:       time.Since(cont.Created).Seconds(),
+			Served:    d.servedBy(cont.Name),
+		}
+		if entry, ok := d.evalQueue.Load(cont.Name); ok {
+			sem := entry.(*semaphore)
+			info.InFlight = sem.InUse()
+			info.Waiting = sem.Waiting()
+		}
+		_, info.Draining = d.draining.Load(cont.Name)
+
+		res = append(res, info)
+	}
+
+	if opts.Stats {
+		wg := &sync.WaitGroup{}
+		for i := range res {
+			wg.Add(1)
+			go func(info *ContainerInfo) {
+				stats, err := d.containerStats(ctx, info.Container)
+				if err != nil {
+					d.logger.Error("failed to read container stats", zap.String("host", info.Host), zap.String("container", info.Name), zap.Error(err))
+				}
+				info.Stats = stats
+				wg.Done()
+			}(&res[i])
+		}
+		wg.Wait()
+	}
+
+	return res, nil
+}
+
+func (d *Docker) containerStats(ctx context.Context, cont Container) (*ContainerStats, error) {
+	const op errors.Op = "docker/Docker.containerStats"
+
+	resp, err := cont.host.cli.ContainerStats(ctx, cont.id, false)
+	if err != nil {
+		d.checkHost(cont.host, err)
+		return nil, errors.E(err, errors.Internal, op)
+	}
+	defer resp.Body.Close()
+
+	stats := types.StatsJSON{}
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return nil, errors.E(err, errors.IO, op)
+	}
+
+	return &ContainerStats{
+		CPUPercent:  cpuPercent(stats),
+		MemoryUsage: stats.MemoryStats.Usage,
+		MemoryLimit: stats.MemoryStats.Limit,
+		PIDs:        stats.PidsStats.Current,
+	}, nil
+}
+
+// cpuPercent computes CPU usage the same way docker stats does.
+func cpuPercent(stats types.StatsJSON) float64 {
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+
+	cpus := float64(stats.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+	return cpuDelta / systemDelta * cpus * 100
+}
+
+func (d *Docker) countServed(contName string) {
+	entry, _ := d.served.LoadOrStore(contName, new(int64))
+	atomic.AddInt64(entry.(*int64), 1)
+}
+
+func (d *Docker) servedBy(contName string) int64 {
+	if entry, ok := d.served.Load(contName); ok {
+		return atomic.LoadInt64(entry.(*int64))
+	}
+	return 0
+}
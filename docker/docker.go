@@ -2,41 +2,57 @@ package docker
 
 import (
 	"context"
-	"fmt"
 	"math/rand"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/bwmarrin/snowflake"
-	"github.com/docker/docker/client"
 	"github.com/hichuyamichu/myriag/config"
 	"github.com/hichuyamichu/myriag/errors"
+	"github.com/hichuyamichu/myriag/eval"
 	"go.uber.org/zap"
 )
 
 var snowflakes, _ = snowflake.NewNode(1)
 
 type Docker struct {
-	cli    *client.Client
+	hosts  []*Host
 	logger *zap.Logger
 
-	// evalQueue stores semaphores (buffered channels) used to limit concurrent evals
+	// evalQueue stores semaphores used to limit concurrent evals per container
 	evalQueue sync.Map
+	// draining stores names of containers no longer receiving new evals
+	draining sync.Map
+	// versions stores language versions captured at build time
+	versions sync.Map
+	// served stores number of evals each container has run
+	served sync.Map
+	// lastUsed stores when each container last finished an eval
+	lastUsed sync.Map
+	// uids stores uids taken by evals running in each container
+	uids sync.Map
+	// updates stores the last UpdateReport of each language
+	updates sync.Map
 }
 
-func New(cli *client.Client, logger *zap.Logger) *Docker {
-	return &Docker{cli: cli, logger: logger}
+func New(hosts []*Host, logger *zap.Logger) *Docker {
+	return &Docker{hosts: hosts, logger: logger}
 }
 
-func (d *Docker) Build(ctx context.Context, langs []string) error {
+func (d *Docker) Languages() []string {
+	return config.Languages()
+}
+
+func (d *Docker) Build(ctx context.Context, langs []string, opts BuildOptions) error {
 	const op errors.Op = "docker/Docker.Build"
 	d.logger.Info("building images", zap.Strings("languages", langs))
 
 	for _, lang := range langs {
-		err := d.build(ctx, lang)
-		if err != nil {
-			return errors.E(err, op)
+		for _, h := range d.healthyHosts() {
+			err := d.build(ctx, h, lang, opts)
+			if err != nil {
+				return errors.E(err, op)
+			}
 		}
 	}
 
@@ -44,21 +60,23 @@ func (d *Docker) Build(ctx context.Context, langs []string) error {
 	return nil
 }
 
-func (d *Docker) BuildConcurrently(ctx context.Context, langs []string) error {
+func (d *Docker) BuildConcurrently(ctx context.Context, langs []string, opts BuildOptions) error {
 	const op errors.Op = "docker/Docker.BuildConcurrently"
 	d.logger.Info("building images concurrently", zap.Strings("languages", langs))
 
 	done := make(chan error)
 	wg := &sync.WaitGroup{}
 	for _, lang := range langs {
-		wg.Add(1)
-		go func(lang string) {
-			err := d.build(ctx, lang)
-			if err != nil {
-				done <- err
-			}
-			wg.Done()
-		}(lang)
+		for _, h := range d.healthyHosts() {
+			wg.Add(1)
+			go func(h *Host, lang string) {
+				err := d.build(ctx, h, lang, opts)
+				if err != nil {
+					done <- err
+				}
+				wg.Done()
+			}(h, lang)
+		}
 	}
 
 	go func() {
@@ -74,37 +92,71 @@ func (d *Docker) BuildConcurrently(ctx context.Context, langs []string) error {
 	return nil
 }
 
-func (d *Docker) Eval(ctx context.Context, lang string, code string) (string, error) {
+// Eval runs code, retrying attempts which failed for reasons unrelated to the code on other containers.
+func (d *Docker) Eval(ctx context.Context, lang string, code string) (eval.Result, error) {
 	const op errors.Op = "docker/Docker.Eval"
 	d.logger.Info("starting eval", zap.String("language", lang), zap.String("code", code))
 
 	if !config.IsLangSupported(lang) {
-		return "", errors.E(errors.LanguageNotFound, op)
+		return eval.Result{}, errors.E(errors.LanguageNotFound, op)
 	}
 
-	contName, err := d.fetchConntainerFor(ctx, lang)
-	if err != nil {
-		return "", errors.E(err, op)
+	maxRetries := config.RetryCountFor(lang)
+	for attempt := 1; ; attempt++ {
+		res, cont, err := d.evalOnce(ctx, lang, code)
+		if err == nil {
+			d.logger.Info("finished eval", zap.String("host", cont.Host), zap.String("container", cont.Name), zap.Int("attempts", attempt), zap.String("verdict", res.Verdict), zap.Any("usage", res.Usage))
+			res.Attempts = attempt
+			return res, nil
+		}
+
+		if !errors.KindOf(err).Retryable() || attempt > maxRetries {
+			d.logger.Error("eval failed", zap.String("language", lang), zap.Int("attempts", attempt), zap.Error(err))
+			return eval.Result{Attempts: attempt}, errors.E(err, op)
+		}
+
+		if cont.Name != "" {
+			d.retire(cont)
+		}
+		delay := backoff(attempt)
+		d.logger.Warn("retrying eval", zap.String("language", lang), zap.String("container", cont.Name), zap.Int("attempt", attempt), zap.Duration("delay", delay), zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return eval.Result{Attempts: attempt}, errors.Done(ctx, op)
+		case <-time.After(delay):
+		}
 	}
+}
 
-	max := config.MaxConcurrentEvlasFor(lang)
-	entry, _ := d.evalQueue.LoadOrStore(contName, make(chan struct{}, max))
-	sem := entry.(chan struct{})
-	sem <- struct{}{}
-	res, err := d.eval(ctx, contName, code)
-	<-sem
+// evalOnce runs code in a container of lang, returning the container it ran in.
+func (d *Docker) evalOnce(ctx context.Context, lang string, code string) (eval.Result, Container, error) {
+	const op errors.Op = "docker/Docker.evalOnce"
+
+	cont, err := d.fetchConntainerFor(ctx, lang)
 	if err != nil {
-		return "", errors.E(err, op)
+		return eval.Result{}, Container{}, errors.E(err, op)
 	}
 
-	maxOut := int(config.MaxOutputFor(lang))
-	actuall := res.Len()
-	if actuall > maxOut {
-		res.Truncate(maxOut)
+	sem, err := d.acquire(ctx, cont, lang)
+	if err != nil {
+		return eval.Result{}, cont, errors.E(err, op)
+	}
+	if !config.QueueConfig().WaitCountsTowardsTimeout {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.TimeoutFor(lang))
+		defer cancel()
+	}
+	d.countServed(cont.Name)
+	res, err := d.eval(ctx, cont, lang, code)
+	d.lastUsed.Store(cont.Name, time.Now())
+	sem.Release()
+	if err != nil {
+		d.checkHost(cont.host, err)
+		return eval.Result{}, cont, errors.E(err, op)
 	}
 
-	d.logger.Info("finished eval", zap.String("container", contName))
-	return res.String(), nil
+	return res, cont, nil
 }
 
 func (d *Docker) SetupContainers(ctx context.Context, langs []string) error {
@@ -145,24 +197,53 @@ func (d *Docker) SetupContainer(ctx context.Context, lang string) (string, error
 		return "", errors.E(errors.LanguageNotFound, op)
 	}
 
-	contName, err := d.setupContainer(ctx, lang)
+	cont, err := d.setupContainer(ctx, lang)
 	if err != nil {
 		return "", errors.E(err, op)
 	}
 
-	d.logger.Info("finished setting up container", zap.String("lang", lang), zap.String("container", contName))
-	return contName, nil
+	d.logger.Info("finished setting up container", zap.String("lang", lang), zap.String("host", cont.Host), zap.String("container", cont.Name))
+	return cont.Name, nil
 }
 
-func (d *Docker) CleanupWithInterval(interval time.Duration) {
+// WarmContainers starts n containers of lang and returns their names.
+func (d *Docker) WarmContainers(ctx context.Context, lang string, n int) ([]string, error) {
+	const op errors.Op = "docker/Docker.WarmContainers"
+
+	res := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		name, err := d.SetupContainer(ctx, lang)
+		if err != nil {
+			return res, errors.E(err, op)
+		}
+		res = append(res, name)
+	}
+	return res, nil
+}
+
+// CleanupOptions selects containers to clean up, zero value selects all of them.
+type CleanupOptions struct {
+	// Language limits cleanup to containers of a single language when not empty.
+	Language string
+	// IdleFor limits cleanup to containers which did not finish an eval for at least this long.
+	IdleFor time.Duration
+}
+
+// CleanupWithInterval evicts containers idle for at least interval, checking every interval until ctx is done.
+func (d *Docker) CleanupWithInterval(ctx context.Context, interval time.Duration) {
 	const _ errors.Op = "docker/Docker.CleanupWithInterval"
 	d.logger.Info("periodic cleanup is set", zap.Duration("interval", interval))
 
 	ticker := time.NewTicker(interval)
 	go func() {
+		defer ticker.Stop()
 		for {
-			<-ticker.C
-			cleaned, err := d.Cleanup(context.Background())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			cleaned, err := d.Cleanup(ctx, CleanupOptions{IdleFor: interval})
 			if err != nil {
 				d.logger.Error("failed to cleanup containers", zap.Error(err))
 			}
@@ -171,82 +252,60 @@ func (d *Docker) CleanupWithInterval(interval time.Duration) {
 	}()
 }
 
-func (d *Docker) Cleanup(ctx context.Context) ([]string, error) {
+// Cleanup drains and kills containers selected by opts. In-flight evals are
+// allowed to finish for up to their language timeout.
+func (d *Docker) Cleanup(ctx context.Context, opts CleanupOptions) ([]string, error) {
 	const op errors.Op = "docker/Docker.Cleanup"
-	d.logger.Info("starting cleanup")
+	d.logger.Info("starting cleanup", zap.String("lang", opts.Language), zap.Duration("idleFor", opts.IdleFor))
 
 	containers, err := d.listContainers(ctx)
 	if err != nil {
 		return nil, errors.E(err, op)
 	}
 
-	res := make([]string, 0)
-	cleaned := make(chan string)
-	wg := &sync.WaitGroup{}
+	selected := make([]Container, 0)
 	for _, cont := range containers {
-		contName := cont.Names[0][1:]
-		wg.Add(1)
-		go func(contID string) {
-			err = d.killContainer(ctx, contID)
-			if err != nil {
-				d.logger.Error("failed to kill container", zap.String("container", contName))
-			} else {
-				cleaned <- contName
+		if opts.Language != "" && cont.Language != opts.Language {
+			continue
+		}
+		if opts.IdleFor > 0 {
+			if time.Since(d.idleSince(cont)) < opts.IdleFor {
+				continue
+			}
+			if entry, ok := d.evalQueue.Load(cont.Name); ok && entry.(*semaphore).InUse() > 0 {
+				continue
 			}
-			wg.Done()
-		}(cont.ID)
-
-		go func() {
-			wg.Wait()
-			close(cleaned)
-		}()
-
-		for cont := range cleaned {
-			res = append(res, cont)
 		}
+		selected = append(selected, cont)
 	}
 
-	return res, nil
+	return d.drain(ctx, selected), nil
 }
 
-func (d *Docker) ListContainers(ctx context.Context) ([]string, error) {
-	const op errors.Op = "docker/Docker.ListContainers"
+func (d *Docker) fetchConntainerFor(ctx context.Context, lang string) (Container, error) {
+	const op errors.Op = "docker/Docker.fetchConntainerFor"
 
 	containers, err := d.listContainers(ctx)
 	if err != nil {
-		return nil, errors.E(err, op)
+		return Container{}, errors.E(err, op)
 	}
 
-	res := make([]string, 0)
+	desiredConts := make([]Container, 0)
 	for _, cont := range containers {
-		contName := cont.Names[0][1:]
-		res = append(res, contName)
-	}
-
-	return res, nil
-}
-
-func (d *Docker) fetchConntainerFor(ctx context.Context, lang string) (string, error) {
-	const op errors.Op = "docker/Docker.fetchConntainerFor"
-
-	containers, err := d.ListContainers(ctx)
-	if err != nil {
-		return "", errors.E(err, op)
-	}
-
-	desiredConts := make([]string, 0)
-	for _, contName := range containers {
-		if strings.HasPrefix(contName, fmt.Sprintf("myriag_%s", lang)) {
-			desiredConts = append(desiredConts, contName)
+		if _, draining := d.draining.Load(cont.Name); draining {
+			continue
+		}
+		if langOf(cont.Name) == lang {
+			desiredConts = append(desiredConts, cont)
 		}
 	}
 
 	if len(desiredConts) == 0 {
-		contName, err := d.SetupContainer(ctx, lang)
+		cont, err := d.setupContainer(ctx, lang)
 		if err != nil {
-			return "", errors.E(err, op)
+			return Container{}, errors.E(err, op)
 		}
-		return contName, nil
+		return cont, nil
 	} else {
 		return desiredConts[rand.Intn(len(desiredConts))], nil
 	}
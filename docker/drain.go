@@ -0,0 +1,164 @@
+package docker
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hichuyamichu/myriag/config"
+	"github.com/hichuyamichu/myriag/errors"
+	"go.uber.org/zap"
+)
+
+// langOf extracts language from container name myriag_<lang>_<snowflake>.
+func langOf(contName string) string {
+	name := strings.TrimPrefix(contName, "myriag_")
+	if i := strings.LastIndexByte(name, '_'); i >= 0 {
+		return name[:i]
+	}
+	return ""
+}
+
+func (d *Docker) semaphoreFor(contName, lang string) *semaphore {
+	if entry, ok := d.evalQueue.Load(contName); ok {
+		return entry.(*semaphore)
+	}
+	entry, _ := d.evalQueue.LoadOrStore(contName, newSemaphore(config.MaxConcurrentEvlasFor(lang)))
+	return entry.(*semaphore)
+}
+
+// acquire takes an eval slot in the container, waiting for one to free up. Evals are admitted
+// and queued by the scheduler, which hands out no more slots than the containers have.
+func (d *Docker) acquire(ctx context.Context, cont Container, lang string) (*semaphore, error) {
+	const op errors.Op = "docker/Docker.acquire"
+
+	sem := d.semaphoreFor(cont.Name, lang)
+	if err := sem.Acquire(ctx); err != nil {
+		return nil, errors.Done(ctx, op)
+	}
+	return sem, nil
+}
+
+// forget drops state kept for a killed container.
+func (d *Docker) forget(contName string) {
+	d.evalQueue.Delete(contName)
+	d.draining.Delete(contName)
+	d.served.Delete(contName)
+	d.lastUsed.Delete(contName)
+	d.uids.Delete(contName)
+}
+
+// idleSince returns when the container last finished an eval, or its creation time if it never ran one.
+func (d *Docker) idleSince(cont Container) time.Time {
+	if entry, ok := d.lastUsed.Load(cont.Name); ok {
+		return entry.(time.Time)
+	}
+	return cont.Created
+}
+
+// ResizeQueues applies the configured concurrency limit of lang to its running containers.
+func (d *Docker) ResizeQueues(lang string) {
+	max := config.MaxConcurrentEvlasFor(lang)
+	d.evalQueue.Range(func(key, value interface{}) bool {
+		if langOf(key.(string)) == lang {
+			value.(*semaphore).SetLimit(max)
+		}
+		return true
+	})
+	d.logger.Info("resized eval queues", zap.String("lang", lang), zap.Int("concurrent", max))
+}
+
+// Drain stops routing evals to containers of lang, waits for in-flight evals to
+// finish for up to the language timeout and kills the containers.
+func (d *Docker) Drain(ctx context.Context, lang string) ([]string, error) {
+	const op errors.Op = "docker/Docker.Drain"
+	d.logger.Info("draining containers", zap.String("lang", lang))
+
+	containers, err := d.listContainers(ctx)
+	if err != nil {
+		return nil, errors.E(err, op)
+	}
+
+	selected := make([]Container, 0)
+	for _, cont := range containers {
+		if cont.Language == lang {
+			selected = append(selected, cont)
+		}
+	}
+
+	res := d.drain(ctx, selected)
+	d.logger.Info("finished draining containers", zap.String("lang", lang), zap.Strings("drained", res))
+	return res, nil
+}
+
+// drain marks containers as draining, waits for each to become idle and kills them concurrently.
+func (d *Docker) drain(ctx context.Context, containers []Container) []string {
+	for _, cont := range containers {
+		d.draining.Store(cont.Name, struct{}{})
+	}
+
+	res := make([]string, 0, len(containers))
+	drained := make(chan string)
+	wg := &sync.WaitGroup{}
+	for _, cont := range containers {
+		wg.Add(1)
+		go func(cont Container) {
+			defer wg.Done()
+			d.waitIdle(ctx, cont.Name, time.Now().Add(config.TimeoutFor(cont.Language)))
+
+			if err := d.killContainer(ctx, cont.host, cont.id); err != nil {
+				d.logger.Error("failed to kill container", zap.String("host", cont.Host), zap.String("container", cont.Name), zap.Error(err))
+				d.draining.Delete(cont.Name)
+				return
+			}
+			d.forget(cont.Name)
+			drained <- cont.Name
+		}(cont)
+	}
+
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+
+	for contName := range drained {
+		res = append(res, contName)
+	}
+	return res
+}
+
+// waitIdle blocks until the container has no evals in flight, deadline passes or ctx is done.
+func (d *Docker) waitIdle(ctx context.Context, contName string, deadline time.Time) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for time.Now().Before(deadline) {
+		entry, ok := d.evalQueue.Load(contName)
+		if !ok || entry.(*semaphore).InUse() == 0 {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Capacity returns the number of evals of lang which can run at once on its containers
+// that are not draining, a container is started on demand when there is none.
+func (d *Docker) Capacity(lang string) int {
+	containers := 0
+	d.evalQueue.Range(func(key, value interface{}) bool {
+		if _, draining := d.draining.Load(key); !draining && langOf(key.(string)) == lang {
+			containers++
+		}
+		return true
+	})
+	if containers == 0 {
+		containers = 1
+	}
+	return containers * config.MaxConcurrentEvlasFor(lang)
+}
@@ -1,60 +1,94 @@
 package docker
 
 import (
-	"bytes"
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/hichuyamichu/myriag/config"
 	"github.com/hichuyamichu/myriag/errors"
+	"github.com/hichuyamichu/myriag/eval"
 	"go.uber.org/zap"
 )
 
-func (d *Docker) eval(ctx context.Context, contName string, code string) (outBuf bytes.Buffer, err error) {
+const rmEvalDirTimeout = 10 * time.Second
+
+// stopMargin is left between the wall time of a program and the timeout of its eval
+// to kill the program and read its report.
+const stopMargin = 2 * time.Second
+
+func (d *Docker) eval(ctx context.Context, cont Container, lang, code string) (res eval.Result, err error) {
 	const op errors.Op = "docker/Docker.eval"
 
 	sf := snowflakes.Generate()
 	dir := fmt.Sprintf("eval/%d", sf)
 
-	d.logger.Debug("creating unique eval dir", zap.String("container", contName), zap.String("dir", dir))
-	err = d.createUniqueEvalDir(ctx, contName, dir)
+	d.logger.Debug("creating unique eval dir", zap.String("container", cont.Name), zap.String("dir", dir))
+	err = d.createUniqueEvalDir(ctx, cont, dir)
 	if err != nil {
-		return outBuf, errors.E(err, op)
+		return res, errors.E(err, op)
 	}
-	d.logger.Debug("unique eval dir created", zap.String("container", contName), zap.String("dir", dir))
+	d.logger.Debug("unique eval dir created", zap.String("container", cont.Name), zap.String("dir", dir))
+
+	uid := d.takeUID(cont.Name)
+
+	// the dir is removed even when the eval fails or ctx expires, the janitor catches what is left
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), rmEvalDirTimeout)
+		defer cancel()
+
+		// processes left in the background must not outlive the eval, the uid is reused by the next one
+		if err := d.killEval(ctx, cont, uid); err != nil {
+			d.logger.Error("failed to kill eval", zap.String("container", cont.Name), zap.Int("uid", uid), zap.Error(err))
+			d.retire(cont)
+		} else {
+			d.releaseUID(cont.Name, uid)
+		}
 
-	d.logger.Debug("chmoding unique eval dir", zap.String("container", contName), zap.String("dir", dir))
-	err = d.chmodUniqueEvalDir(ctx, contName, dir)
+		d.logger.Debug("removing unique eval dir", zap.String("container", cont.Name), zap.String("dir", dir))
+		if err := d.rmUniqueEvalDir(ctx, cont, dir); err != nil {
+			d.logger.Error("failed to remove unique eval dir", zap.Error(err))
+		} else {
+			d.logger.Debug("unique eval dir removed", zap.String("container", cont.Name), zap.String("dir", dir))
+		}
+	}()
+
+	d.logger.Debug("chmoding unique eval dir", zap.String("container", cont.Name), zap.String("dir", dir))
+	err = d.chmodUniqueEvalDir(ctx, cont, dir)
 	if err != nil {
-		return outBuf, errors.E(err, op)
+		return res, errors.E(err, op)
 	}
-	d.logger.Debug("chmoded unique eval dir", zap.String("container", contName), zap.String("dir", dir))
+	d.logger.Debug("chmoded unique eval dir", zap.String("container", cont.Name), zap.String("dir", dir))
 
-	d.logger.Debug("evaluating code", zap.String("container", contName), zap.String("dir", dir))
-	res, err := d.runExec(ctx, contName, dir, code)
+	err = d.createReportDir(ctx, cont, dir)
 	if err != nil {
-		return outBuf, errors.E(err, op)
+		return res, errors.E(err, op)
 	}
-	d.logger.Debug("code evaluated", zap.String("container", contName), zap.String("dir", dir))
 
-	d.logger.Debug("removing unique eval dir", zap.String("container", contName), zap.String("dir", dir))
-	err = d.rmUniqueEvalDir(ctx, contName, dir)
+	err = d.startWatchdog(ctx, cont, lang, dir, uid)
 	if err != nil {
-		d.logger.Error("failed to remove unique eval dir", zap.Error(err))
-	} else {
-		d.logger.Debug("unique eval dir removed", zap.String("container", contName), zap.String("dir", dir))
+		return res, errors.E(err, op)
 	}
 
+	d.logger.Debug("evaluating code", zap.String("container", cont.Name), zap.String("dir", dir))
+	res, err = d.runExec(ctx, cont, lang, dir, uid, code)
+	if err != nil {
+		return res, errors.E(err, op)
+	}
+	d.logger.Debug("code evaluated", zap.String("container", cont.Name), zap.String("dir", dir))
+
 	return res, nil
 }
 
-func (d *Docker) createUniqueEvalDir(ctx context.Context, contName, dir string) error {
+func (d *Docker) createUniqueEvalDir(ctx context.Context, cont Container, dir string) error {
 	const op errors.Op = "docker/Docker.createUniqueEvalDir"
 
-	iresp, err := d.cli.ContainerExecCreate(
+	iresp, err := cont.host.cli.ContainerExecCreate(
 		ctx,
-		contName,
+		cont.Name,
 		types.ExecConfig{
 			Cmd: []string{"mkdir", dir},
 		},
@@ -63,19 +97,19 @@ func (d *Docker) createUniqueEvalDir(ctx context.Context, contName, dir string)
 		return errors.E(err, errors.Internal, op)
 	}
 
-	if err := d.cli.ContainerExecStart(ctx, iresp.ID, types.ExecStartCheck{}); err != nil {
+	if err := cont.host.cli.ContainerExecStart(ctx, iresp.ID, types.ExecStartCheck{}); err != nil {
 		return errors.E(err, errors.Internal, op)
 	}
 
 	return nil
 }
 
-func (d *Docker) chmodUniqueEvalDir(ctx context.Context, contName, dir string) error {
+func (d *Docker) chmodUniqueEvalDir(ctx context.Context, cont Container, dir string) error {
 	const op errors.Op = "docker/Docker.chmodUniqueEvalDir"
 
-	iresp, err := d.cli.ContainerExecCreate(
+	iresp, err := cont.host.cli.ContainerExecCreate(
 		ctx,
-		contName,
+		cont.Name,
 		types.ExecConfig{
 			Cmd: []string{"chmod", "777", dir},
 		},
@@ -84,89 +118,196 @@ func (d *Docker) chmodUniqueEvalDir(ctx context.Context, contName, dir string) e
 		return errors.E(err, errors.Internal, op)
 	}
 
-	if err := d.cli.ContainerExecStart(ctx, iresp.ID, types.ExecStartCheck{}); err != nil {
+	if err := cont.host.cli.ContainerExecStart(ctx, iresp.ID, types.ExecStartCheck{}); err != nil {
 		return errors.E(err, errors.Internal, op)
 	}
 
 	return nil
 }
 
-func (d *Docker) runExec(ctx context.Context, contName, dir, code string) (outBuf bytes.Buffer, err error) {
+// runExec runs code in dir. The process is killed once it writes more than the output limit of lang
+// or runs longer than its wall time, the output read until then is returned.
+func (d *Docker) runExec(ctx context.Context, cont Container, lang, dir string, uid int, code string) (res eval.Result, err error) {
 	const op errors.Op = "docker/Docker.runExec"
 
-	iresp, err := d.cli.ContainerExecCreate(
+	iresp, err := cont.host.cli.ContainerExecCreate(
 		ctx,
-		contName,
+		cont.Name,
 		types.ExecConfig{
-			User:         "1001:1001",
+			User:         fmt.Sprintf("%d:%d", uid, uid),
 			AttachStdout: true,
 			AttachStderr: true,
 			AttachStdin:  true,
 			WorkingDir:   fmt.Sprintf("/tmp/%s", dir),
-			// /bin/sh /var/run/run.sh 2>&1 | head -c
-			Cmd: []string{"/bin/sh", "/var/run/run.sh"},
+			Cmd:          wrapCommand(lang, config.CommandFor(lang)),
 		},
 	)
 	if err != nil {
-		return outBuf, errors.E(err, errors.Internal, op)
+		return res, errors.E(err, errors.Internal, op)
 	}
 
-	aresp, err := d.cli.ContainerExecAttach(ctx, iresp.ID, types.ExecStartCheck{})
+	start := time.Now()
+	aresp, err := cont.host.cli.ContainerExecAttach(ctx, iresp.ID, types.ExecStartCheck{})
 	if err != nil {
-		return outBuf, errors.E(err, errors.Internal, op)
+		return res, errors.E(err, errors.Internal, op)
 	}
 	defer aresp.Close()
 
 	_, err = aresp.Conn.Write([]byte(code))
 	if err != nil {
-		return outBuf, errors.E(err, errors.Internal, op)
+		return res, errors.E(err, errors.Internal, op)
 	}
 
 	err = aresp.CloseWrite()
 	if err != nil {
-		return outBuf, errors.E(err, errors.Internal, op)
+		return res, errors.E(err, errors.Internal, op)
 	}
 
-	outputDone := make(chan error)
+	out := &limitWriter{limit: int(config.MaxOutputFor(lang))}
+	outputDone := make(chan error, 1)
 	go func() {
-		_, err = stdcopy.StdCopy(&outBuf, &outBuf, aresp.Reader)
+		_, err := stdcopy.StdCopy(out, out, aresp.Reader)
 		outputDone <- err
 	}()
 
+	// preparing the eval counts towards its timeout but not towards the wall time, the program
+	// is stopped early enough to be reported as exceeding its wall time rather than timing out
+	limit := config.EvalLimitsFor(lang).WallTime
+	if deadline, ok := ctx.Deadline(); ok {
+		if left := time.Until(deadline) - stopMargin; left < limit {
+			limit = left
+		}
+	}
+	wallTime := time.NewTimer(limit)
+	defer wallTime.Stop()
+
 	select {
 	case err := <-outputDone:
+		if err == errOutputLimit {
+			d.logger.Debug("output limit exceeded", zap.String("container", cont.Name), zap.String("dir", dir), zap.Int64("bytes", out.n))
+			// a program left writing would hold the slot, the container is retired when it can not be killed
+			d.stopEval(cont, uid)
+			usage, _ := d.usageOf(ctx, cont, dir, 0, start)
+			return eval.Result{Output: out.buf.String(), Truncated: true, OutputBytes: out.n, Usage: usage, Verdict: eval.OutputLimitExceeded}, nil
+		}
 		if err != nil {
-			return outBuf, errors.E(err, errors.Internal, op)
+			return res, errors.E(err, errors.Internal, op)
 		}
 		break
 
+	case <-wallTime.C:
+		d.logger.Debug("wall time exceeded", zap.String("container", cont.Name), zap.String("dir", dir))
+		if !d.stopEval(cont, uid) {
+			// processes which survived keep the stream open, the output read so far is returned
+			aresp.Close()
+		}
+		// output written until the kill is kept, the stream ends once the processes are gone
+		select {
+		case <-outputDone:
+		case <-ctx.Done():
+			return res, errors.Done(ctx, op)
+		}
+		usage, _ := d.usageOf(ctx, cont, dir, 0, start)
+		truncated := out.n > int64(out.buf.Len())
+		return eval.Result{Output: out.buf.String(), Truncated: truncated, OutputBytes: out.n, Usage: usage, Verdict: eval.WallTimeExceeded}, nil
+
 	case <-ctx.Done():
-		return outBuf, errors.E(errors.Errorf("evaluation timeout"), errors.EvalTimeout, op)
+		d.stopEval(cont, uid)
+		return res, errors.Done(ctx, op)
 	}
 
-	_, err = d.cli.ContainerExecInspect(ctx, iresp.ID)
+	inspect, err := cont.host.cli.ContainerExecInspect(ctx, iresp.ID)
 	if err != nil {
-		return outBuf, errors.E(err, errors.Internal, op)
+		return res, errors.E(err, errors.Internal, op)
+	}
+
+	usage, verdict := d.usageOf(ctx, cont, dir, inspect.ExitCode, start)
+	if verdict != eval.OK {
+		d.logger.Info("eval stopped by a limit", zap.String("container", cont.Name), zap.String("dir", dir), zap.String("verdict", verdict))
 	}
 
-	return outBuf, nil
+	return eval.Result{Output: out.buf.String(), OutputBytes: out.n, Usage: usage, Verdict: verdict}, nil
+}
+
+// usageOf returns resources used by the eval in dir started at start and the limit it ran into.
+// The report is informational, an eval is not failed when it can not be read.
+func (d *Docker) usageOf(ctx context.Context, cont Container, dir string, exitCode int, start time.Time) (eval.Usage, string) {
+	wall := time.Since(start)
+	usage, verdict, err := d.readReport(ctx, cont, dir, exitCode)
+	if err != nil {
+		d.logger.Error("failed to read eval report", zap.String("container", cont.Name), zap.String("dir", dir), zap.Error(err))
+		verdict = eval.OK
+	}
+	usage.WallTime = wall.Seconds()
+	return usage, verdict
+}
+
+// stopEval kills processes of an eval which is given up on and reports whether they are gone.
+// It gets its own context as the one of the eval may be done already. A container running
+// processes which can not be killed is retired rather than the eval failing, so user code
+// is never run again on another container while it may still be running here.
+func (d *Docker) stopEval(cont Container, uid int) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), rmEvalDirTimeout)
+	defer cancel()
+	if err := d.killEval(ctx, cont, uid); err != nil {
+		d.logger.Error("failed to kill eval", zap.String("container", cont.Name), zap.Int("uid", uid), zap.Error(err))
+		d.retire(cont)
+		return false
+	}
+	return true
+}
+
+// killEval kills processes running as uid, retrying while they fork, and fails when any survive.
+func (d *Docker) killEval(ctx context.Context, cont Container, uid int) error {
+	const op errors.Op = "docker/Docker.killEval"
+
+	if err := d.killProcesses(ctx, cont, "-eq", uid); err != nil {
+		return errors.E(err, op)
+	}
+	return nil
+}
+
+// killProcesses kills processes whose uid compares with uid using the test operator, retrying
+// while they fork, and fails when any survive.
+func (d *Docker) killProcesses(ctx context.Context, cont Container, test string, uid int) error {
+	const op errors.Op = "docker/Docker.killProcesses"
+
+	script := fmt.Sprintf(`for i in 1 2 3 4 5; do
+	pids=$(%s)
+	[ -z "$pids" ] && exit 0
+	kill -9 $pids 2>/dev/null
+	sleep 0.1
+done
+echo "processes survived: $pids"
+exit 1`, fmt.Sprintf(listProcesses, test, uid))
+
+	code, out, err := d.execOutput(ctx, cont, []string{"/bin/sh", "-c", script})
+	if err != nil {
+		return errors.E(err, op)
+	}
+	if code != 0 {
+		return errors.E(errors.Errorf("exited with %d: %s", code, strings.TrimSpace(out)), errors.Internal, op)
+	}
+	return nil
 }
 
-func (d *Docker) rmUniqueEvalDir(ctx context.Context, contName, dir string) error {
+func (d *Docker) rmUniqueEvalDir(ctx context.Context, cont Container, dir string) error {
 	const op errors.Op = "docker/Docker.rmUniqueEvalDir"
 
-	iresp, err := d.cli.ContainerExecCreate(
+	iresp, err := cont.host.cli.ContainerExecCreate(
 		ctx,
-		contName,
+		cont.Name,
 		types.ExecConfig{
-			Cmd: []string{"rm", "-rf", dir},
+			// files of the program are not necessarily removable by the container user
+			User: "0",
+			Cmd:  []string{"rm", "-rf", dir, reportDir(dir)},
 		},
 	)
 	if err != nil {
 		return errors.E(err, errors.Internal, op)
 	}
 
-	if err := d.cli.ContainerExecStart(ctx, iresp.ID, types.ExecStartCheck{}); err != nil {
+	if err := cont.host.cli.ContainerExecStart(ctx, iresp.ID, types.ExecStartCheck{}); err != nil {
 		return errors.E(err, errors.Internal, op)
 	}
 
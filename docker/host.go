@@ -0,0 +1,113 @@
+package docker
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/hichuyamichu/myriag/errors"
+	"go.uber.org/zap"
+)
+
+// Host is a single Docker daemon containers can be placed on.
+type Host struct {
+	Name   string
+	Weight int
+
+	cli     *client.Client
+	healthy int32
+}
+
+func NewHost(name string, cli *client.Client, weight int) *Host {
+	if weight <= 0 {
+		weight = 1
+	}
+	return &Host{Name: name, Weight: weight, cli: cli, healthy: 1}
+}
+
+// Healthy reports whether the host accepts new containers and evals.
+func (h *Host) Healthy() bool {
+	return atomic.LoadInt32(&h.healthy) == 1
+}
+
+// setHealthy updates health of the host and reports whether it changed.
+func (h *Host) setHealthy(healthy bool) bool {
+	var v int32
+	if healthy {
+		v = 1
+	}
+	return atomic.SwapInt32(&h.healthy, v) != v
+}
+
+func (d *Docker) healthyHosts() []*Host {
+	res := make([]*Host, 0, len(d.hosts))
+	for _, h := range d.hosts {
+		if h.Healthy() {
+			res = append(res, h)
+		}
+	}
+	return res
+}
+
+// checkHost marks the host as unhealthy if err indicates the daemon is unreachable.
+func (d *Docker) checkHost(h *Host, err error) {
+	if err == nil || !client.IsErrConnectionFailed(err) {
+		return
+	}
+	if h.setHealthy(false) {
+		d.logger.Error("host marked unhealthy", zap.String("host", h.Name), zap.Error(err))
+	}
+}
+
+// pickHost selects a healthy host with the lowest number of containers relative to its weight.
+func (d *Docker) pickHost(load map[*Host]int) (*Host, error) {
+	const op errors.Op = "docker/Docker.pickHost"
+
+	var best *Host
+	var bestScore float64
+	for _, h := range d.healthyHosts() {
+		score := float64(load[h]+1) / float64(h.Weight)
+		if best == nil || score < bestScore {
+			best = h
+			bestScore = score
+		}
+	}
+
+	if best == nil {
+		return nil, errors.E(errors.Errorf("no healthy docker hosts"), errors.Internal, op)
+	}
+	return best, nil
+}
+
+// MonitorHosts periodically pings every host, draining unreachable ones and
+// restoring them once they respond again. Monitoring stops when ctx is done.
+func (d *Docker) MonitorHosts(ctx context.Context, interval time.Duration) {
+	const _ errors.Op = "docker/Docker.MonitorHosts"
+	d.logger.Info("host monitoring is set", zap.Duration("interval", interval))
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			for _, h := range d.hosts {
+				ctx, cancel := context.WithTimeout(ctx, interval)
+				_, err := h.cli.Ping(ctx)
+				cancel()
+
+				if err != nil {
+					if h.setHealthy(false) {
+						d.logger.Error("host marked unhealthy", zap.String("host", h.Name), zap.Error(err))
+					}
+				} else if h.setHealthy(true) {
+					d.logger.Info("host marked healthy", zap.String("host", h.Name))
+				}
+			}
+		}
+	}()
+}
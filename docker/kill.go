@@ -7,15 +7,39 @@ import (
 	"go.uber.org/zap"
 )
 
-func (d *Docker) killContainer(ctx context.Context, contID string) error {
+func (d *Docker) killContainer(ctx context.Context, h *Host, contID string) error {
 	const op errors.Op = "docker/Docker.killContainer"
-	d.logger.Debug("starting container kill", zap.String("id", contID))
+	d.logger.Debug("starting container kill", zap.String("host", h.Name), zap.String("id", contID))
 
-	err := d.cli.ContainerKill(ctx, contID, "")
+	err := h.cli.ContainerKill(ctx, contID, "")
 	if err != nil {
+		d.checkHost(h, err)
 		return errors.E(err, errors.Internal, op)
 	}
 
 	d.logger.Debug("container killed", zap.String("id", contID))
 	return nil
 }
+
+// KillContainer kills the owned container called name.
+func (d *Docker) KillContainer(ctx context.Context, name string) (Container, error) {
+	const op errors.Op = "docker/Docker.KillContainer"
+
+	containers, err := d.listContainers(ctx)
+	if err != nil {
+		return Container{}, errors.E(err, op)
+	}
+
+	for _, cont := range containers {
+		if cont.Name != name {
+			continue
+		}
+		if err := d.killContainer(ctx, cont.host, cont.id); err != nil {
+			return Container{}, errors.E(err, op)
+		}
+		d.forget(cont.Name)
+		return cont, nil
+	}
+
+	return Container{}, errors.E(errors.ContainerNotFound, op)
+}
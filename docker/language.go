@@ -0,0 +1,133 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/hichuyamichu/myriag/config"
+	"github.com/hichuyamichu/myriag/errors"
+	"go.uber.org/zap"
+)
+
+// LanguageStatus is the runtime state of a language.
+type LanguageStatus struct {
+	// Version is the output of the manifest version command captured at build time.
+	Version string `json:"version"`
+	// Image is the ID of the language image.
+	Image string `json:"image"`
+	// ImageBuilt reports whether the image exists on every healthy host.
+	ImageBuilt bool `json:"imageBuilt"`
+	Containers int  `json:"containers"`
+	Warm       bool `json:"warm"`
+}
+
+// LanguageStatuses returns runtime state of langs.
+func (d *Docker) LanguageStatuses(ctx context.Context, langs []string) (map[string]LanguageStatus, error) {
+	const op errors.Op = "docker/Docker.LanguageStatuses"
+
+	containers, err := d.listContainers(ctx)
+	if err != nil {
+		return nil, errors.E(err, op)
+	}
+
+	res := make(map[string]LanguageStatus, len(langs))
+	for _, lang := range langs {
+		status := LanguageStatus{ImageBuilt: true}
+		if version, ok := d.versions.Load(lang); ok {
+			status.Version = version.(string)
+		}
+
+		for _, h := range d.healthyHosts() {
+			img, _, err := h.cli.ImageInspectWithRaw(ctx, config.ImageFor(lang))
+			if err != nil {
+				d.checkHost(h, err)
+				status.ImageBuilt = false
+				continue
+			}
+			status.Image = img.ID
+		}
+
+		for _, cont := range containers {
+			if langOf(cont.Name) == lang {
+				status.Containers++
+			}
+		}
+		status.Warm = status.Containers > 0
+
+		res[lang] = status
+	}
+
+	return res, nil
+}
+
+// captureVersion runs the manifest version command in a throwaway container and stores its output.
+func (d *Docker) captureVersion(ctx context.Context, h *Host, lang string) error {
+	const op errors.Op = "docker/Docker.captureVersion"
+
+	m := config.ManifestFor(lang)
+	if m == nil || m.Version == "" {
+		return nil
+	}
+
+	cresp, err := h.cli.ContainerCreate(ctx,
+		&container.Config{
+			Image:           config.ImageFor(lang),
+			User:            "1000:1000",
+			WorkingDir:      "/tmp/",
+			NetworkDisabled: true,
+			Entrypoint:      []string{"/bin/sh", "-c"},
+			Cmd:             []string{m.Version},
+		},
+		&container.HostConfig{
+			Resources: container.Resources{
+				NanoCPUs:   config.NanoCPUFor(lang),
+				Memory:     config.MemoryFor(lang),
+				MemorySwap: config.MemoryFor(lang),
+			},
+		},
+		nil,
+		"",
+	)
+	if err != nil {
+		return errors.E(err, errors.Internal, op)
+	}
+	defer func() {
+		err := h.cli.ContainerRemove(context.Background(), cresp.ID, types.ContainerRemoveOptions{Force: true})
+		if err != nil {
+			d.logger.Error("failed to remove version container", zap.String("host", h.Name), zap.Error(err))
+		}
+	}()
+
+	if err := h.cli.ContainerStart(ctx, cresp.ID, types.ContainerStartOptions{}); err != nil {
+		return errors.E(err, errors.Internal, op)
+	}
+
+	waitc, errc := h.cli.ContainerWait(ctx, cresp.ID, container.WaitConditionNotRunning)
+	select {
+	case <-waitc:
+	case err := <-errc:
+		return errors.E(err, errors.Internal, op)
+	}
+
+	logs, err := h.cli.ContainerLogs(ctx, cresp.ID, types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true})
+	if err != nil {
+		return errors.E(err, errors.Internal, op)
+	}
+	defer logs.Close()
+
+	var out bytes.Buffer
+	if _, err := stdcopy.StdCopy(&out, &out, logs); err != nil {
+		return errors.E(err, errors.IO, op)
+	}
+
+	version := strings.TrimSpace(out.String())
+	if i := strings.IndexByte(version, '\n'); i >= 0 {
+		version = version[:i]
+	}
+	d.versions.Store(lang, version)
+	return nil
+}
@@ -3,25 +3,67 @@ package docker
 import (
 	"context"
 	"strings"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/hichuyamichu/myriag/errors"
+	"go.uber.org/zap"
 )
 
-func (d *Docker) listContainers(ctx context.Context) ([]types.Container, error) {
+// Container is a myriag owned container together with the host it runs on.
+type Container struct {
+	Name     string `json:"name"`
+	Host     string `json:"host"`
+	Language string `json:"language"`
+	// Image is the digest of the image the container was created from.
+	Image   string    `json:"image"`
+	Created time.Time `json:"created"`
+	Status  string    `json:"status"`
+
+	id   string
+	host *Host
+}
+
+func (d *Docker) listContainers(ctx context.Context) ([]Container, error) {
 	const op errors.Op = "docker/Docker.listContainers"
 
-	containers, err := d.cli.ContainerList(ctx, types.ContainerListOptions{})
-	if err != nil {
-		return nil, errors.E(err, errors.Internal, op)
+	hosts := d.healthyHosts()
+	if len(hosts) == 0 {
+		return nil, errors.E(errors.Errorf("no healthy docker hosts"), errors.Internal, op)
 	}
 
-	res := make([]types.Container, 0)
-	for _, cont := range containers {
-		contName := cont.Names[0][1:]
-		if strings.HasPrefix(contName, "myriag_") {
-			res = append(res, cont)
+	res := make([]Container, 0)
+	failed := 0
+	var lastErr error
+	for _, h := range hosts {
+		containers, err := h.cli.ContainerList(ctx, types.ContainerListOptions{})
+		if err != nil {
+			d.checkHost(h, err)
+			d.logger.Error("failed to list containers", zap.String("host", h.Name), zap.Error(err))
+			failed++
+			lastErr = err
+			continue
 		}
+
+		for _, cont := range containers {
+			contName := cont.Names[0][1:]
+			if strings.HasPrefix(contName, "myriag_") {
+				res = append(res, Container{
+					Name:     contName,
+					Host:     h.Name,
+					Language: langOf(contName),
+					Image:    cont.ImageID,
+					Created:  time.Unix(cont.Created, 0),
+					Status:   cont.State,
+					id:       cont.ID,
+					host:     h,
+				})
+			}
+		}
+	}
+
+	if failed == len(hosts) {
+		return nil, errors.E(lastErr, errors.Internal, op)
 	}
 	return res, nil
 }
@@ -0,0 +1,27 @@
+package docker
+
+import (
+	"bytes"
+
+	"github.com/hichuyamichu/myriag/errors"
+)
+
+// errOutputLimit stops copying exec output once the output limit is exceeded.
+var errOutputLimit = errors.Str("output limit exceeded")
+
+// limitWriter keeps up to limit bytes and counts every byte written to it.
+type limitWriter struct {
+	buf   bytes.Buffer
+	limit int
+	// n is the number of bytes observed, including the ones not kept
+	n int64
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	if room := w.limit - w.buf.Len(); len(p) > room {
+		w.buf.Write(p[:room])
+		return room, errOutputLimit
+	}
+	return w.buf.Write(p)
+}
@@ -0,0 +1,197 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/hichuyamichu/myriag/config"
+	"github.com/hichuyamichu/myriag/errors"
+	"go.uber.org/zap"
+)
+
+// ReconcileReport lists containers found on startup.
+type ReconcileReport struct {
+	Adopted []string `json:"adopted"`
+	Killed  []string `json:"killed"`
+}
+
+// Reconcile decides what to do with containers left by a previous run. Containers of enabled
+// languages running the current image and responding to exec are adopted and their leftover
+// eval dirs removed, the rest is killed.
+func (d *Docker) Reconcile(ctx context.Context) (ReconcileReport, error) {
+	const op errors.Op = "docker/Docker.Reconcile"
+	d.logger.Info("reconciling existing containers")
+
+	report := ReconcileReport{Adopted: make([]string, 0), Killed: make([]string, 0)}
+	containers, err := d.listContainers(ctx)
+	if err != nil {
+		return report, errors.E(err, op)
+	}
+
+	// images caches current image IDs by host and language
+	images := make(map[string]string)
+	for _, cont := range containers {
+		reason := ""
+		if !config.IsLangSupported(cont.Language) {
+			reason = "language not enabled"
+		}
+
+		if reason == "" {
+			key := fmt.Sprintf("%s/%s", cont.Host, cont.Language)
+			if _, ok := images[key]; !ok {
+				img, _, err := cont.host.cli.ImageInspectWithRaw(ctx, config.ImageFor(cont.Language))
+				if err != nil {
+					d.checkHost(cont.host, err)
+				}
+				images[key] = img.ID
+			}
+			if images[key] != cont.Image {
+				reason = "stale image"
+			}
+		}
+
+		if reason == "" {
+			if code, err := d.execWait(ctx, cont, []string{"test", "-d", "eval"}); err != nil || code != 0 {
+				reason = "unhealthy"
+			}
+		}
+
+		// evals of the previous run are not tracked and their uids are handed out again
+		if reason == "" {
+			if err := d.killProcesses(ctx, cont, "-ge", firstEvalUID); err != nil {
+				d.logger.Error("failed to kill leftover evals", zap.String("host", cont.Host), zap.String("container", cont.Name), zap.Error(err))
+				reason = "leftover evals"
+			}
+		}
+
+		if reason != "" {
+			if err := d.killContainer(ctx, cont.host, cont.id); err != nil {
+				d.logger.Error("failed to kill container", zap.String("host", cont.Host), zap.String("container", cont.Name), zap.Error(err))
+				continue
+			}
+			d.forget(cont.Name)
+			d.logger.Info("killed existing container", zap.String("host", cont.Host), zap.String("container", cont.Name), zap.String("reason", reason))
+			report.Killed = append(report.Killed, cont.Name)
+			continue
+		}
+
+		if err := d.cleanEvalDirs(ctx, cont, 0); err != nil {
+			d.logger.Error("failed to remove leftover eval dirs", zap.String("host", cont.Host), zap.String("container", cont.Name), zap.Error(err))
+		}
+		d.logger.Info("adopted existing container", zap.String("host", cont.Host), zap.String("container", cont.Name))
+		report.Adopted = append(report.Adopted, cont.Name)
+	}
+
+	d.logger.Info("finished reconciling containers", zap.Strings("adopted", report.Adopted), zap.Strings("killed", report.Killed))
+	return report, nil
+}
+
+// JanitorWithInterval removes eval dirs older than their language timeout every interval until ctx is done.
+// Those are left behind by evals which failed before cleaning up after themselves.
+func (d *Docker) JanitorWithInterval(ctx context.Context, interval time.Duration) {
+	const _ errors.Op = "docker/Docker.JanitorWithInterval"
+	d.logger.Info("eval dir janitor is set", zap.Duration("interval", interval))
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			containers, err := d.listContainers(ctx)
+			if err != nil {
+				d.logger.Error("failed to list containers", zap.Error(err))
+				continue
+			}
+			for _, cont := range containers {
+				if err := d.cleanEvalDirs(ctx, cont, config.TimeoutFor(cont.Language)); err != nil {
+					d.logger.Error("failed to remove old eval dirs", zap.String("host", cont.Host), zap.String("container", cont.Name), zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// cleanEvalDirs removes eval dirs of the container last modified more than age ago and their report dirs.
+func (d *Docker) cleanEvalDirs(ctx context.Context, cont Container, age time.Duration) error {
+	const op errors.Op = "docker/Docker.cleanEvalDirs"
+
+	script := fmt.Sprintf(`now=$(date +%%s)
+for dir in eval/*; do
+	[ -d "$dir" ] || continue
+	[ $((now - $(stat -c %%Y "$dir"))) -ge %d ] && rm -rf "$dir"
+done
+# report dirs are kept fresh by watchdogs, they go with their eval dirs, which stops the watchdogs
+for dir in /run/myriag/*; do
+	[ -d "$dir" ] && [ ! -d "eval/${dir##*/}" ] && rm -rf "$dir"
+done
+exit 0`, int(age.Seconds()))
+
+	code, err := d.execWait(ctx, cont, []string{"/bin/sh", "-c", script})
+	if err != nil {
+		return errors.E(err, op)
+	}
+	if code != 0 {
+		return errors.E(errors.Errorf("exited with %d", code), errors.Internal, op)
+	}
+	return nil
+}
+
+// execWait runs cmd in the container as root, waits for it to finish and returns its exit code.
+func (d *Docker) execWait(ctx context.Context, cont Container, cmd []string) (int, error) {
+	const op errors.Op = "docker/Docker.execWait"
+
+	code, _, err := d.execOutput(ctx, cont, cmd)
+	if err != nil {
+		return 0, errors.E(err, op)
+	}
+	return code, nil
+}
+
+// execOutput runs cmd in the container as root, waits for it to finish and returns its exit code and output.
+func (d *Docker) execOutput(ctx context.Context, cont Container, cmd []string) (int, string, error) {
+	const op errors.Op = "docker/Docker.execOutput"
+
+	iresp, err := cont.host.cli.ContainerExecCreate(
+		ctx,
+		cont.Name,
+		types.ExecConfig{
+			User:         "0",
+			AttachStdout: true,
+			AttachStderr: true,
+			Cmd:          cmd,
+		},
+	)
+	if err != nil {
+		d.checkHost(cont.host, err)
+		return 0, "", errors.E(err, errors.Internal, op)
+	}
+
+	aresp, err := cont.host.cli.ContainerExecAttach(ctx, iresp.ID, types.ExecStartCheck{})
+	if err != nil {
+		return 0, "", errors.E(err, errors.Internal, op)
+	}
+	defer aresp.Close()
+
+	var out bytes.Buffer
+	if _, err := stdcopy.StdCopy(&out, &out, aresp.Reader); err != nil {
+		return 0, "", errors.E(err, errors.IO, op)
+	}
+
+	inspect, err := cont.host.cli.ContainerExecInspect(ctx, iresp.ID)
+	if err != nil {
+		return 0, "", errors.E(err, errors.Internal, op)
+	}
+	if inspect.ExitCode != 0 {
+		d.logger.Debug("exec failed", zap.String("container", cont.Name), zap.Strings("cmd", cmd), zap.Int("code", inspect.ExitCode), zap.String("output", out.String()))
+	}
+	return inspect.ExitCode, out.String(), nil
+}
@@ -0,0 +1,40 @@
+package docker
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/hichuyamichu/myriag/config"
+	"go.uber.org/zap"
+)
+
+// backoff returns exponential delay before the next attempt with full jitter,
+// so evals retried at the same time do not hit the hosts at once again.
+func backoff(attempt int) time.Duration {
+	policy := config.RetryPolicy()
+
+	max := policy.BaseDelay << uint(attempt-1)
+	if max > policy.MaxDelay || max <= 0 {
+		max = policy.MaxDelay
+	}
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+// retire marks a container which failed an eval as unhealthy. It stops receiving evals
+// and is killed once evals in flight finish.
+func (d *Docker) retire(cont Container) {
+	if _, loaded := d.draining.LoadOrStore(cont.Name, struct{}{}); loaded {
+		return
+	}
+	d.logger.Warn("container marked unhealthy", zap.String("host", cont.Host), zap.String("container", cont.Name))
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), config.TimeoutFor(cont.Language)+time.Minute)
+		defer cancel()
+		d.drain(ctx, []Container{cont})
+	}()
+}
@@ -0,0 +1,107 @@
+package docker
+
+import (
+	"context"
+	"sync"
+)
+
+// semaphore limits concurrent evals in a container, unlike a buffered channel its limit can be changed.
+type semaphore struct {
+	mu      sync.Mutex
+	limit   int
+	inUse   int
+	waiters []chan struct{}
+}
+
+func newSemaphore(limit int) *semaphore {
+	return &semaphore{limit: limit}
+}
+
+// Acquire blocks until a slot is free or ctx is done.
+func (s *semaphore) Acquire(ctx context.Context) error {
+	s.mu.Lock()
+	if s.inUse < s.limit && len(s.waiters) == 0 {
+		s.inUse++
+		s.mu.Unlock()
+		return nil
+	}
+
+	ready := make(chan struct{})
+	s.waiters = append(s.waiters, ready)
+	s.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		select {
+		case <-ready:
+			// slot was granted meanwhile, hand it over to the next waiter
+			s.inUse--
+			s.notify()
+		default:
+			s.remove(ready)
+		}
+		return ctx.Err()
+	}
+}
+
+// TryAcquire takes a slot if one is free without waiting.
+func (s *semaphore) TryAcquire() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inUse < s.limit && len(s.waiters) == 0 {
+		s.inUse++
+		return true
+	}
+	return false
+}
+
+func (s *semaphore) Release() {
+	s.mu.Lock()
+	s.inUse--
+	s.notify()
+	s.mu.Unlock()
+}
+
+// SetLimit changes the number of slots, evals above a lowered limit are allowed to finish.
+func (s *semaphore) SetLimit(limit int) {
+	s.mu.Lock()
+	s.limit = limit
+	s.notify()
+	s.mu.Unlock()
+}
+
+// InUse returns the number of acquired slots.
+func (s *semaphore) InUse() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inUse
+}
+
+// Waiting returns the number of callers blocked in Acquire.
+func (s *semaphore) Waiting() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.waiters)
+}
+
+// notify grants free slots to waiters in order, s.mu must be held.
+func (s *semaphore) notify() {
+	for s.inUse < s.limit && len(s.waiters) > 0 {
+		s.inUse++
+		close(s.waiters[0])
+		s.waiters = s.waiters[1:]
+	}
+}
+
+func (s *semaphore) remove(ready chan struct{}) {
+	for i, w := range s.waiters {
+		if w == ready {
+			s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+			return
+		}
+	}
+}
@@ -3,6 +3,7 @@ package docker
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -12,41 +13,66 @@ import (
 	"github.com/hichuyamichu/myriag/errors"
 )
 
-func (d *Docker) setupContainer(ctx context.Context, lang string) (string, error) {
+func (d *Docker) setupContainer(ctx context.Context, lang string) (Container, error) {
 	const op errors.Op = "docker/Docker.setupContainer"
 
-	imageName := fmt.Sprintf("myriag_%s", lang)
+	containers, err := d.listContainers(ctx)
+	if err != nil {
+		return Container{}, errors.E(err, op)
+	}
+
+	load := make(map[*Host]int)
+	for _, cont := range containers {
+		load[cont.host]++
+	}
+
+	h, err := d.pickHost(load)
+	if err != nil {
+		return Container{}, errors.E(err, op)
+	}
+
+	imageName := config.ImageFor(lang)
 	sf := snowflakes.Generate()
 	contName := fmt.Sprintf("myriag_%s_%d", lang, sf)
 
-	d.logger.Debug("starting container", zap.String("lang", lang), zap.String("container", contName))
-	err := d.startContainer(ctx, imageName, contName, lang)
+	d.logger.Debug("starting container", zap.String("host", h.Name), zap.String("lang", lang), zap.String("container", contName))
+	contID, err := d.startContainer(ctx, h, imageName, contName, lang)
 	if err != nil {
-		return "", errors.E(err, op)
+		d.checkHost(h, err)
+		return Container{}, errors.E(err, op)
+	}
+	d.logger.Debug("started container", zap.String("host", h.Name), zap.String("lang", lang), zap.String("container", contName))
+	cont := Container{
+		Name:     contName,
+		Host:     h.Name,
+		Language: lang,
+		Created:  time.Now(),
+		Status:   "running",
+		id:       contID,
+		host:     h,
 	}
-	d.logger.Debug("started container", zap.String("lang", lang), zap.String("container", contName))
 
 	d.logger.Debug("creating eval dir", zap.String("container", contName))
-	err = d.createEvalDir(ctx, contName)
+	err = d.createEvalDir(ctx, cont)
 	if err != nil {
-		return "", errors.E(err, op)
+		return Container{}, errors.E(err, op)
 	}
 	d.logger.Debug("created eval dir", zap.String("container", contName))
 
 	d.logger.Debug("chmoding eval dir", zap.String("container", contName))
-	err = d.chmodEvalDir(ctx, contName)
+	err = d.chmodEvalDir(ctx, cont)
 	if err != nil {
-		return "", errors.E(err, op)
+		return Container{}, errors.E(err, op)
 	}
 	d.logger.Debug("chmoded eval dir", zap.String("container", contName))
 
-	return contName, nil
+	return cont, nil
 }
 
-func (d *Docker) startContainer(ctx context.Context, imageName, contName, lang string) error {
+func (d *Docker) startContainer(ctx context.Context, h *Host, imageName, contName, lang string) (string, error) {
 	const op errors.Op = "docker/Docker.startContainer"
 
-	cresp, err := d.cli.ContainerCreate(ctx,
+	cresp, err := h.cli.ContainerCreate(ctx,
 		&container.Config{
 			Image:           imageName,
 			User:            "1000:1000",
@@ -67,23 +93,23 @@ func (d *Docker) startContainer(ctx context.Context, imageName, contName, lang s
 		contName,
 	)
 	if err != nil {
-		return errors.E(err, errors.Internal, op)
+		return "", errors.E(err, errors.Internal, op)
 	}
 
-	err = d.cli.ContainerStart(ctx, cresp.ID, types.ContainerStartOptions{})
+	err = h.cli.ContainerStart(ctx, cresp.ID, types.ContainerStartOptions{})
 	if err != nil {
-		return errors.E(err, errors.Internal, op)
+		return "", errors.E(err, errors.Internal, op)
 	}
 
-	return nil
+	return cresp.ID, nil
 }
 
-func (d *Docker) createEvalDir(ctx context.Context, contName string) error {
+func (d *Docker) createEvalDir(ctx context.Context, cont Container) error {
 	const op errors.Op = "docker/Docker.createEvalDir"
 
-	iresp, err := d.cli.ContainerExecCreate(
+	iresp, err := cont.host.cli.ContainerExecCreate(
 		ctx,
-		contName,
+		cont.Name,
 		types.ExecConfig{
 			Cmd: []string{"mkdir", "eval"},
 		},
@@ -92,19 +118,19 @@ func (d *Docker) createEvalDir(ctx context.Context, contName string) error {
 		return errors.E(err, errors.Internal, op)
 	}
 
-	if err := d.cli.ContainerExecStart(ctx, iresp.ID, types.ExecStartCheck{}); err != nil {
+	if err := cont.host.cli.ContainerExecStart(ctx, iresp.ID, types.ExecStartCheck{}); err != nil {
 		return errors.E(err, errors.Internal, op)
 	}
 
 	return nil
 }
 
-func (d *Docker) chmodEvalDir(ctx context.Context, contName string) error {
+func (d *Docker) chmodEvalDir(ctx context.Context, cont Container) error {
 	const op errors.Op = "docker/Docker.chmodEvalDir"
 
-	iresp, err := d.cli.ContainerExecCreate(
+	iresp, err := cont.host.cli.ContainerExecCreate(
 		ctx,
-		contName,
+		cont.Name,
 		types.ExecConfig{
 			Cmd: []string{"chmod", "711", "eval"},
 		},
@@ -113,7 +139,7 @@ func (d *Docker) chmodEvalDir(ctx context.Context, contName string) error {
 		return errors.E(err, errors.Internal, op)
 	}
 
-	if err := d.cli.ContainerExecStart(ctx, iresp.ID, types.ExecStartCheck{}); err != nil {
+	if err := cont.host.cli.ContainerExecStart(ctx, iresp.ID, types.ExecStartCheck{}); err != nil {
 		return errors.E(err, errors.Internal, op)
 	}
 
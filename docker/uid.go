@@ -0,0 +1,55 @@
+package docker
+
+import "sync"
+
+// firstEvalUID is the uid of the first eval running in a container. Every eval running at once gets
+// its own uid, so its processes can be found and killed wherever they chdir to and can not signal
+// processes of other evals.
+const firstEvalUID = 1001
+
+// listProcesses prints pids of processes whose uid compares with the test operator and the uid it is
+// formatted with, zombies are skipped as they are gone already, only not reaped yet.
+const listProcesses = `for p in /proc/[0-9]*; do
+	state=; id=
+	while read -r k v _; do
+		case $k in
+		State:) state=$v ;;
+		Uid:) id=$v; break ;;
+		esac
+	done 2>/dev/null < "$p/status"
+	[ -n "$id" ] && [ "$id" %[1]s %[2]d ] && [ "$state" != Z ] && echo "${p#/proc/}"
+done`
+
+// uidPool hands out uids to evals of a container.
+type uidPool struct {
+	mu   sync.Mutex
+	used map[int]bool
+}
+
+// takeUID returns the lowest uid not used by an eval running in the container.
+func (d *Docker) takeUID(contName string) int {
+	entry, _ := d.uids.LoadOrStore(contName, &uidPool{used: make(map[int]bool)})
+	pool := entry.(*uidPool)
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	uid := firstEvalUID
+	for pool.used[uid] {
+		uid++
+	}
+	pool.used[uid] = true
+	return uid
+}
+
+// releaseUID returns uid to the pool of the container, none of its processes may be left running.
+func (d *Docker) releaseUID(contName string, uid int) {
+	entry, ok := d.uids.Load(contName)
+	if !ok {
+		return
+	}
+	pool := entry.(*uidPool)
+
+	pool.mu.Lock()
+	delete(pool.used, uid)
+	pool.mu.Unlock()
+}
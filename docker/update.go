@@ -0,0 +1,72 @@
+package docker
+
+import (
+	"context"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/hichuyamichu/myriag/config"
+	"github.com/hichuyamichu/myriag/errors"
+	"go.uber.org/zap"
+)
+
+// UpdateFailure describes a container whose limits could not be updated.
+type UpdateFailure struct {
+	Container string `json:"container"`
+	Host      string `json:"host"`
+	Error     string `json:"error"`
+}
+
+// UpdateReport lists containers of a language after applying its limits.
+type UpdateReport struct {
+	Lang    string          `json:"language"`
+	At      time.Time       `json:"at"`
+	Updated []string        `json:"updated"`
+	Failed  []UpdateFailure `json:"failed"`
+}
+
+// UpdateLimits applies the configured memory and CPU limits of lang to its running containers.
+// Containers which could not be updated keep their old limits and are listed in the report.
+func (d *Docker) UpdateLimits(ctx context.Context, lang string) (UpdateReport, error) {
+	const op errors.Op = "docker/Docker.UpdateLimits"
+
+	report := UpdateReport{Lang: lang, At: time.Now(), Updated: make([]string, 0), Failed: make([]UpdateFailure, 0)}
+	containers, err := d.listContainers(ctx)
+	if err != nil {
+		return report, errors.E(err, op)
+	}
+
+	resources := container.Resources{
+		NanoCPUs:   config.NanoCPUFor(lang),
+		Memory:     config.MemoryFor(lang),
+		MemorySwap: config.MemoryFor(lang),
+	}
+
+	for _, cont := range containers {
+		if langOf(cont.Name) != lang {
+			continue
+		}
+
+		_, err := cont.host.cli.ContainerUpdate(ctx, cont.id, container.UpdateConfig{Resources: resources})
+		if err != nil {
+			d.checkHost(cont.host, err)
+			d.logger.Error("failed to update container limits", zap.String("host", cont.Host), zap.String("container", cont.Name), zap.Error(err))
+			report.Failed = append(report.Failed, UpdateFailure{Container: cont.Name, Host: cont.Host, Error: err.Error()})
+			continue
+		}
+		report.Updated = append(report.Updated, cont.Name)
+	}
+
+	d.logger.Info("updated container limits", zap.String("lang", lang), zap.Int("updated", len(report.Updated)), zap.Int("failed", len(report.Failed)))
+	d.updates.Store(lang, report)
+	return report, nil
+}
+
+// LastUpdate returns the report of the last time limits of lang were applied, by a config reload
+// or the admin API.
+func (d *Docker) LastUpdate(lang string) (UpdateReport, bool) {
+	if entry, ok := d.updates.Load(lang); ok {
+		return entry.(UpdateReport), true
+	}
+	return UpdateReport{}, false
+}
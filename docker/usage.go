@@ -0,0 +1,122 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/hichuyamichu/myriag/config"
+	"github.com/hichuyamichu/myriag/errors"
+	"github.com/hichuyamichu/myriag/eval"
+)
+
+// evalWrapper applies per process limits and runs the command given as its arguments. Once it exits,
+// the wrapper stops until the watchdog has read CPU time of the program from it.
+// The data limit stops a process allocating more than the eval may use at once, before the
+// watchdog sees it and before the container runs out of memory.
+const evalWrapper = `ulimit -S -t %[1]d && ulimit -H -t %[2]d && ulimit -f %[3]d && ulimit -d %[4]d || { echo "failed to set limits" >&2; exit 1; }
+"$@"
+code=$?
+kill -STOP $$
+exit $code`
+
+// wrapCommand wraps cmd so it runs within limits of lang and resources it uses can be read with readReport.
+func wrapCommand(lang string, cmd []string) []string {
+	limits := config.EvalLimitsFor(lang)
+	// SIGXCPU is sent at the soft limit, the hard one kills processes ignoring it
+	cpuTime := int(limits.CPUTime.Seconds())
+	// the data limit is in kilobytes
+	script := fmt.Sprintf(evalWrapper, cpuTime, cpuTime+1, fileSizeBlocks(limits.FileSize), limits.Memory/1024)
+	return append([]string{"/bin/sh", "-c", script, "sh"}, cmd...)
+}
+
+// fileSizeBlocks returns size in blocks of 512 bytes, the unit ulimit -f takes.
+func fileSizeBlocks(size int64) int64 {
+	return (size + 511) / 512
+}
+
+// reportDir is where the watchdog records resources used by the eval in dir and the limit it ran into.
+// It is owned by root, unlike the eval dir, so the program can not forge the report.
+func reportDir(dir string) string {
+	return "/run/myriag/" + path.Base(dir)
+}
+
+func (d *Docker) createReportDir(ctx context.Context, cont Container, dir string) error {
+	const op errors.Op = "docker/Docker.createReportDir"
+
+	code, err := d.execWait(ctx, cont, []string{"/bin/sh", "-c", fmt.Sprintf("mkdir -p /run/myriag && mkdir -m 700 %s", reportDir(dir))})
+	if err != nil {
+		return errors.E(err, op)
+	}
+	if code != 0 {
+		return errors.E(errors.Errorf("exited with %d", code), errors.Internal, op)
+	}
+	return nil
+}
+
+// readReport reads CPU time, peak memory and the verdict recorded by the watchdog of the eval in dir.
+// exitCode is the exit code of the wrapper as reported by docker, limits enforced by the kernel show
+// up only there.
+func (d *Docker) readReport(ctx context.Context, cont Container, dir string, exitCode int) (eval.Usage, string, error) {
+	const op errors.Op = "docker/Docker.readReport"
+
+	script := fmt.Sprintf(`cd %s || exit 1
+printf 'usage '; cat usage 2>/dev/null; echo
+printf 'verdict '; head -n 1 verdict 2>/dev/null; echo`, reportDir(dir))
+
+	code, out, err := d.execOutput(ctx, cont, []string{"/bin/sh", "-c", script})
+	if err != nil {
+		return eval.Usage{}, "", errors.E(err, op)
+	}
+	if code != 0 {
+		return eval.Usage{}, "", errors.E(errors.Errorf("exited with %d", code), errors.Internal, op)
+	}
+	usage, verdict := parseReport(out, exitCode)
+	return usage, verdict, nil
+}
+
+// Exit codes of processes killed by SIGXCPU and SIGXFSZ.
+const (
+	exitCPUTime  = 128 + 24
+	exitFileSize = 128 + 25
+)
+
+// clockTicks is the number of clock ticks in a second on every architecture docker runs on.
+const clockTicks = 100
+
+// parseReport parses output of readReport, figures which are missing are left zero
+// and the verdict is OK unless a limit was hit.
+func parseReport(out string, exitCode int) (eval.Usage, string) {
+	usage := eval.Usage{}
+	verdict := eval.OK
+	switch exitCode {
+	case exitCPUTime:
+		verdict = eval.CPUTimeExceeded
+	case exitFileSize:
+		verdict = eval.FileSizeExceeded
+	}
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case strings.HasPrefix(line, "usage "):
+			// user and system time in clock ticks and peak memory in kilobytes
+			fields := strings.Fields(strings.TrimPrefix(line, "usage "))
+			if len(fields) == 3 {
+				user, _ := strconv.ParseInt(fields[0], 10, 64)
+				sys, _ := strconv.ParseInt(fields[1], 10, 64)
+				kb, _ := strconv.ParseInt(fields[2], 10, 64)
+				usage.UserTime = float64(user) / clockTicks
+				usage.SysTime = float64(sys) / clockTicks
+				usage.PeakMemory = kb * 1024
+			}
+		case strings.HasPrefix(line, "verdict "):
+			// processes killed by the watchdog exit like any killed process
+			switch v := strings.TrimSpace(strings.TrimPrefix(line, "verdict ")); v {
+			case eval.OOMKilled, eval.ProcessLimitExceeded, eval.CPUTimeExceeded:
+				verdict = v
+			}
+		}
+	}
+	return usage, verdict
+}
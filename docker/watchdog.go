@@ -0,0 +1,91 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+	"github.com/hichuyamichu/myriag/config"
+	"github.com/hichuyamichu/myriag/errors"
+	"github.com/hichuyamichu/myriag/eval"
+)
+
+// watchdog samples processes of an eval until its report dir is removed. Once they use more memory,
+// CPU time or processes than a single eval may, the verdict is recorded and they are killed, so the
+// kernel does not have to pick a victim among all evals of the container. The highest CPU time and
+// memory seen are recorded as usage, a stopped process is sampled before it is continued so the
+// wrapper can hand over CPU time of the program once it exits.
+// CPU time of a process is its own and that of its exited children, in clock ticks.
+// Files of /proc are read with builtins only, forking for every process would load the container
+// as much as the programs it watches.
+const watchdog = `run=%[1]s
+user=0; sys=0; peak=0
+while [ -d "$run" ]; do
+	u=0; s=0; rss=0; n=0; pids=; stopped=
+	for p in /proc/[0-9]*; do
+		id=; kb=0
+		while read -r k v _; do
+			case $k in
+			Uid:) id=$v; [ "$v" = %[2]d ] || break ;;
+			VmRSS:) kb=$v; break ;;
+			esac
+		done 2>/dev/null < "$p/status"
+		[ "$id" = %[2]d ] || continue
+		read -r line 2>/dev/null < "$p/stat" || continue
+		# the command name in parentheses may contain spaces
+		set -- ${line##*) }
+		[ $# -ge 15 ] || continue
+		u=$((u + ${12} + ${14})); s=$((s + ${13} + ${15}))
+		# zombies are gone already, only not reaped yet
+		[ "$1" = Z ] && continue
+		n=$((n + 1))
+		pids="$pids ${p#/proc/}"
+		[ "$1" = T ] && stopped="$stopped ${p#/proc/}"
+		rss=$((rss + kb))
+	done
+	[ "$u" -gt "$user" ] && user=$u
+	[ "$s" -gt "$sys" ] && sys=$s
+	[ "$rss" -gt "$peak" ] && peak=$rss
+	echo "$user $sys $peak" > "$run/usage.tmp" && mv "$run/usage.tmp" "$run/usage"
+	verdict=
+	[ "$rss" -gt %[3]d ] && verdict=%[4]s
+	[ $((u + s)) -gt %[5]d ] && verdict=%[6]s
+	[ "$n" -gt %[7]d ] && verdict=%[8]s
+	if [ -n "$verdict" ]; then
+		echo "$verdict" > "$run/verdict"
+		kill -9 $pids 2>/dev/null
+	fi
+	[ -n "$stopped" ] && kill -CONT $stopped 2>/dev/null
+	sleep 0.1
+done`
+
+// startWatchdog starts enforcing per eval limits of lang on processes running as uid. It runs as root
+// so the program can not kill it and stops by itself once the report dir of the eval in dir is removed.
+func (d *Docker) startWatchdog(ctx context.Context, cont Container, lang, dir string, uid int) error {
+	const op errors.Op = "docker/Docker.startWatchdog"
+
+	limits := config.EvalLimitsFor(lang)
+	ticks := int64(limits.CPUTime.Seconds() * clockTicks)
+	// shells running the program are not counted
+	script := fmt.Sprintf(watchdog, reportDir(dir), uid, limits.Memory/1024, eval.OOMKilled,
+		ticks, eval.CPUTimeExceeded, limits.Processes+3, eval.ProcessLimitExceeded)
+
+	iresp, err := cont.host.cli.ContainerExecCreate(
+		ctx,
+		cont.Name,
+		types.ExecConfig{
+			// the container user can neither inspect nor kill processes of the program
+			User: "0",
+			Cmd:  []string{"/bin/sh", "-c", script},
+		},
+	)
+	if err != nil {
+		return errors.E(err, errors.Internal, op)
+	}
+
+	if err := cont.host.cli.ContainerExecStart(ctx, iresp.ID, types.ExecStartCheck{Detach: true}); err != nil {
+		return errors.E(err, errors.Internal, op)
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package errors
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"log"
 	"runtime"
@@ -63,12 +64,18 @@ type Kind uint8
 
 // Kinds of errors.
 const (
-	Other            Kind = iota // Unclassified error.
-	Invalid                      // Invalid operation for this type of item.
-	IO                           // External I/O error such as network failure.
-	Internal                     // Internal error or inconsistency.
-	EvalTimeout                  // Evaluation timed out.
-	LanguageNotFound             // Language not found.
+	Other             Kind = iota // Unclassified error.
+	Invalid                       // Invalid operation for this type of item.
+	IO                            // External I/O error such as network failure.
+	Internal                      // Internal error or inconsistency.
+	EvalTimeout                   // Evaluation timed out.
+	LanguageNotFound              // Language not found.
+	Unavailable                   // No capacity to serve the request.
+	Unauthorized                  // Missing or invalid credentials.
+	BuildFailed                   // Image build failed.
+	ContainerNotFound             // Container not found.
+	QueueFull                     // Too many evals waiting.
+	Canceled                      // Request canceled by the client.
 )
 
 func (k Kind) String() string {
@@ -85,6 +92,18 @@ func (k Kind) String() string {
 		return "evaluation timed out"
 	case LanguageNotFound:
 		return "language not found"
+	case Unavailable:
+		return "service unavailable"
+	case Unauthorized:
+		return "unauthorized"
+	case BuildFailed:
+		return "image build failed"
+	case ContainerNotFound:
+		return "container not found"
+	case QueueFull:
+		return "too many requests"
+	case Canceled:
+		return "request canceled"
 	}
 	return "unknown error kind"
 }
@@ -104,10 +123,41 @@ func (k Kind) HTTPStatus() int {
 		return 513
 	case LanguageNotFound:
 		return 404
+	case Unavailable:
+		return 503
+	case Unauthorized:
+		return 401
+	case BuildFailed:
+		return 500
+	case ContainerNotFound:
+		return 404
+	case QueueFull:
+		return 429
+	case Canceled:
+		// nonstandard, the client is gone and never sees it
+		return 499
 	}
 	return 500
 }
 
+// Retryable reports whether an operation failing with this kind may succeed when retried.
+func (k Kind) Retryable() bool {
+	switch k {
+	case IO, Internal:
+		return true
+	}
+	return false
+}
+
+// Done returns an error telling why evaluation under ctx stopped, EvalTimeout once its
+// deadline passed and Canceled when the client went away.
+func Done(ctx context.Context, op Op) error {
+	if ctx.Err() == context.Canceled {
+		return E(Errorf("evaluation canceled"), Canceled, op)
+	}
+	return E(Errorf("evaluation timeout"), EvalTimeout, op)
+}
+
 // E builds an error value from its arguments.
 func E(args ...interface{}) error {
 	if len(args) == 0 {
@@ -178,6 +228,21 @@ func Is(err error, kind Kind) bool {
 	return false
 }
 
+// KindOf returns the first kind other than Other found in err.
+func KindOf(err error) Kind {
+	e, ok := err.(*Error)
+	if !ok {
+		return Other
+	}
+	if e.Kind != Other {
+		return e.Kind
+	}
+	if e.Err != nil {
+		return KindOf(e.Err)
+	}
+	return Other
+}
+
 func Str(text string) error {
 	return &errorString{text}
 }
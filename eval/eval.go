@@ -0,0 +1,45 @@
+// Package eval holds types shared by evaluation backends.
+package eval
+
+// Result is the outcome of an evaluation.
+type Result struct {
+	Output string `json:"result"`
+	// Attempts is the number of times the code was run, failed attempts are retried.
+	Attempts int `json:"attempts"`
+	// Truncated is set when the output limit was exceeded, the eval is stopped then.
+	Truncated bool `json:"truncated"`
+	// OutputBytes is the number of output bytes observed, more than Output holds when truncated.
+	OutputBytes int64 `json:"outputBytes"`
+	// Usage is measured for the last attempt.
+	Usage Usage `json:"usage"`
+	// Verdict tells whether the program finished on its own or was stopped by a limit.
+	Verdict string `json:"verdict"`
+}
+
+// Verdicts of an evaluation.
+const (
+	// OK means the program finished on its own, whatever its exit code.
+	OK = "ok"
+	// OOMKilled means the program was killed for using more memory than a single eval may.
+	OOMKilled = "oom_killed"
+	// ProcessLimitExceeded means the program was killed for running too many processes.
+	ProcessLimitExceeded = "process_limit_exceeded"
+	// CPUTimeExceeded means the program used up its CPU time.
+	CPUTimeExceeded = "cpu_time_exceeded"
+	// WallTimeExceeded means the program ran for longer than allowed, sleeping and waiting included.
+	WallTimeExceeded = "wall_time_exceeded"
+	// FileSizeExceeded means the program wrote a file larger than allowed.
+	FileSizeExceeded = "file_size_exceeded"
+	// OutputLimitExceeded means the program was killed for writing more output than allowed.
+	OutputLimitExceeded = "output_limit_exceeded"
+)
+
+// Usage is resources used by an evaluation, compiling the code included.
+type Usage struct {
+	// WallTime, UserTime and SysTime are in seconds.
+	WallTime float64 `json:"wallTime"`
+	UserTime float64 `json:"userTime"`
+	SysTime  float64 `json:"sysTime"`
+	// PeakMemory is the peak resident memory of all processes together in bytes, 0 when it could not be measured.
+	PeakMemory int64 `json:"peakMemory"`
+}
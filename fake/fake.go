@@ -0,0 +1,50 @@
+package fake
+
+import (
+	"context"
+
+	"github.com/hichuyamichu/myriag/config"
+	"github.com/hichuyamichu/myriag/errors"
+	"github.com/hichuyamichu/myriag/eval"
+	"go.uber.org/zap"
+)
+
+// Backend is an evaluation backend that does not run anything and echoes submitted
+// code back instead. It allows exercising the http and cluster layers without docker.
+type Backend struct {
+	logger *zap.Logger
+}
+
+func New(logger *zap.Logger) *Backend {
+	return &Backend{logger: logger}
+}
+
+func (b *Backend) Languages() []string {
+	return config.Languages()
+}
+
+func (b *Backend) Eval(ctx context.Context, lang string, code string) (eval.Result, error) {
+	const op errors.Op = "fake/Backend.Eval"
+	b.logger.Info("starting fake eval", zap.String("language", lang))
+
+	if !config.IsLangSupported(lang) {
+		return eval.Result{}, errors.E(errors.LanguageNotFound, op)
+	}
+
+	select {
+	case <-ctx.Done():
+		return eval.Result{Attempts: 1}, errors.Done(ctx, op)
+	default:
+	}
+
+	res := eval.Result{Output: code, Attempts: 1, OutputBytes: int64(len(code)), Verdict: eval.OK}
+	maxOut := int(config.MaxOutputFor(lang))
+	if len(res.Output) > maxOut {
+		res.Output = res.Output[:maxOut]
+		res.Truncated = true
+		res.Verdict = eval.OutputLimitExceeded
+	}
+
+	b.logger.Info("finished fake eval", zap.String("language", lang))
+	return res, nil
+}
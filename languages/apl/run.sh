@@ -1,2 +0,0 @@
-cat > program.apl
-apl --OFF -s -f program.apl
@@ -1,2 +0,0 @@
-cat > program.sh
-bash program.sh
@@ -1,2 +0,0 @@
-cat > program.c
-gcc program.c -o program && ./program
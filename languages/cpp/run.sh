@@ -1,2 +0,0 @@
-cat > program.cpp
-g++ program.cpp -o program && ./program
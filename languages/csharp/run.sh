@@ -1,2 +0,0 @@
-cat > program.cs
-csc -nologo program.cs 2>/dev/null && mono program.exe
@@ -1,2 +0,0 @@
-cat > program.exs
-elixir program.exs
@@ -1,2 +0,0 @@
-cat > program.fs
-fsharpc --optimize- program.fs >/dev/null && mono program.exe
@@ -1,3 +0,0 @@
-export GOCACHE=/tmp/"$CODEDIR"/cache
-cat > program.go
-go run program.go
@@ -1,2 +0,0 @@
-cat > program.hs
-ghc -e main program.hs
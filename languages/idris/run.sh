@@ -1,2 +0,0 @@
-cat > Main.idr
-idris --execute ./Main.idr
@@ -1,2 +0,0 @@
-cat > Main.java
-javac Main.java && java Main
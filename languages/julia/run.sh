@@ -1,2 +0,0 @@
-cat > program.jl
-julia program.jl
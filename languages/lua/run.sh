@@ -1,2 +0,0 @@
-cat > program.lua
-lua5.3 program.lua
@@ -1,2 +0,0 @@
-cat > program.nim
-nim compile --run --colors=off --memTracker=off --verbosity=0 --hints=off --nimcache:/tmp/"$CODEDIR"/cache ./program.nim
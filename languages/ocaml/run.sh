@@ -1,2 +0,0 @@
-cat > program.ml
-ocamlopt -cclib --static -o program program.ml && ./program
@@ -1,2 +0,0 @@
-cat > program.pl
-perl program.pl
@@ -1,2 +0,0 @@
-cat > program.php
-php program.php
@@ -1,2 +0,0 @@
-cat > program.pl
-swipl --quiet program.pl
@@ -1,2 +0,0 @@
-cat > program.py
-python program.py
@@ -1,2 +0,0 @@
-cat > program.R
-Rscript program.R
@@ -1,2 +0,0 @@
-cat > program.rkt
-racket program.rkt
@@ -1,2 +0,0 @@
-cat > program.rb
-ruby program.rb
@@ -1,2 +0,0 @@
-cat > program.rs
-rustc -C opt-level=0 --color never program.rs && ./program
@@ -0,0 +1,104 @@
+package markdown
+
+import (
+	"strings"
+)
+
+// Block is a fenced code block.
+type Block struct {
+	// Info is the first word of the fence info string, usually the language.
+	Info string `json:"info"`
+	Code string `json:"code"`
+}
+
+// Blocks extracts fenced code blocks from text.
+func Blocks(text string) []Block {
+	blocks, _ := parse(text)
+	return blocks
+}
+
+// Single returns the block if text consists of exactly one fenced block.
+func Single(text string) (Block, bool) {
+	blocks, other := parse(text)
+	if len(blocks) != 1 || other {
+		return Block{}, false
+	}
+	return blocks[0], true
+}
+
+// parse returns fenced blocks of text and whether text contains anything else than blocks.
+func parse(text string) ([]Block, bool) {
+	res := make([]Block, 0)
+	other := false
+
+	var (
+		inBlock bool
+		char    byte
+		length  int
+		info    string
+		code    []string
+	)
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		trimmed := strings.TrimLeft(line, " \t")
+
+		if !inBlock {
+			c, n := fence(trimmed)
+			if n == 0 {
+				if strings.TrimSpace(line) != "" {
+					other = true
+				}
+				continue
+			}
+
+			rest := trimmed[n:]
+			// ```code``` on a single line, as used by chat clients
+			if c == '`' && strings.HasSuffix(rest, strings.Repeat("`", n)) && len(rest) > n {
+				res = append(res, Block{Code: rest[:len(rest)-n]})
+				continue
+			}
+			if c == '`' && strings.ContainsRune(rest, '`') {
+				other = true
+				continue
+			}
+
+			inBlock, char, length, code = true, c, n, nil
+			info = ""
+			if fields := strings.Fields(rest); len(fields) > 0 {
+				info = fields[0]
+			}
+			continue
+		}
+
+		if c, n := fence(trimmed); c == char && n >= length && strings.TrimSpace(trimmed[n:]) == "" {
+			res = append(res, Block{Info: info, Code: strings.Join(code, "\n")})
+			inBlock = false
+			continue
+		}
+		code = append(code, line)
+	}
+
+	// unclosed block runs until the end of text
+	if inBlock {
+		res = append(res, Block{Info: info, Code: strings.Join(code, "\n")})
+	}
+
+	return res, other
+}
+
+// fence returns fence character and length if line opens or closes a fenced block.
+func fence(line string) (byte, int) {
+	if len(line) < 3 || (line[0] != '`' && line[0] != '~') {
+		return 0, 0
+	}
+
+	n := 0
+	for n < len(line) && line[n] == line[0] {
+		n++
+	}
+	if n < 3 {
+		return 0, 0
+	}
+	return line[0], n
+}
@@ -0,0 +1,101 @@
+package scheduler
+
+import (
+	"container/heap"
+	"time"
+)
+
+// flow is a stream of evals sharing slots fairly with other flows.
+type flow struct {
+	client string
+	class  string
+}
+
+type job struct {
+	flow     flow
+	finish   float64
+	seq      uint64
+	enqueued time.Time
+	ready    chan struct{}
+	index    int
+}
+
+// queue holds evals of a language waiting for a slot. Jobs are tagged with virtual finish
+// times, a flow with twice the weight advances half as fast and is served twice as often.
+type queue struct {
+	running int
+	jobs    jobHeap
+	// virtual is the finish tag of the last dispatched job
+	virtual float64
+	// last stores the finish tag of the last queued job of each flow
+	last map[flow]float64
+	seq  uint64
+}
+
+func newQueue() *queue {
+	return &queue{last: make(map[flow]float64)}
+}
+
+func (q *queue) push(f flow, weight float64) *job {
+	start := q.virtual
+	if last, ok := q.last[f]; ok && last > start {
+		start = last
+	}
+
+	q.seq++
+	j := &job{
+		flow:     f,
+		finish:   start + 1/weight,
+		seq:      q.seq,
+		enqueued: time.Now(),
+		ready:    make(chan struct{}),
+	}
+	q.last[f] = j.finish
+	heap.Push(&q.jobs, j)
+	return j
+}
+
+func (q *queue) pop() *job {
+	j := heap.Pop(&q.jobs).(*job)
+	q.virtual = j.finish
+
+	// flows without queued work restart from the virtual time
+	for f, last := range q.last {
+		if last <= q.virtual {
+			delete(q.last, f)
+		}
+	}
+	return j
+}
+
+type jobHeap []*job
+
+func (h jobHeap) Len() int { return len(h) }
+
+func (h jobHeap) Less(i, j int) bool {
+	if h[i].finish != h[j].finish {
+		return h[i].finish < h[j].finish
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h jobHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *jobHeap) Push(x interface{}) {
+	j := x.(*job)
+	j.index = len(*h)
+	*h = append(*h, j)
+}
+
+func (h *jobHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	j := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return j
+}
@@ -0,0 +1,214 @@
+package scheduler
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hichuyamichu/myriag/config"
+	"github.com/hichuyamichu/myriag/errors"
+	"go.uber.org/zap"
+)
+
+// Scheduler dispatches evals of every language to its slots using weighted fair queueing.
+// Each client of each class is a flow, a flow gets share of slots relative to the weight of its class
+// so a single client can not monopolize a language and interactive evals overtake batched ones.
+type Scheduler struct {
+	// capacity returns the number of evals of a language allowed to run at once
+	capacity func(lang string) int
+	logger   *zap.Logger
+
+	mu     sync.Mutex
+	queues map[string]*queue
+	queued int
+	stats  map[string]*classStats
+}
+
+func New(capacity func(lang string) int, logger *zap.Logger) *Scheduler {
+	return &Scheduler{
+		capacity: capacity,
+		logger:   logger,
+		queues:   make(map[string]*queue),
+		stats:    make(map[string]*classStats),
+	}
+}
+
+// Acquire waits for a slot of lang, returning a function releasing it.
+func (s *Scheduler) Acquire(ctx context.Context, lang, client, class string) (func(), error) {
+	const op errors.Op = "scheduler/Scheduler.Acquire"
+
+	classes := config.SchedulerClasses()
+	weight, ok := classes[class]
+	if !ok {
+		return nil, errors.E(errors.Errorf("unknown priority class %q", class), errors.Invalid, op)
+	}
+
+	s.mu.Lock()
+	q := s.queueFor(lang)
+	stats := s.statsFor(class)
+
+	if q.running < s.slots(lang) && q.jobs.Len() == 0 {
+		q.running++
+		stats.dispatched++
+		s.mu.Unlock()
+		return s.releaseFunc(lang), nil
+	}
+
+	if q.jobs.Len() >= config.QueueDepthFor(lang) {
+		stats.rejected++
+		s.mu.Unlock()
+		s.logger.Warn("language queue is full", zap.String("lang", lang), zap.String("class", class))
+		return nil, errors.E(errors.Errorf("queue of %s is full", lang), errors.QueueFull, op)
+	}
+	if s.queued >= config.QueueConfig().Depth {
+		stats.rejected++
+		s.mu.Unlock()
+		s.logger.Warn("global queue is full", zap.String("class", class))
+		return nil, errors.E(errors.Errorf("global queue is full"), errors.Unavailable, op)
+	}
+
+	j := q.push(flow{client: client, class: class}, float64(weight))
+	s.queued++
+	stats.queued++
+	s.mu.Unlock()
+
+	waitCtx := ctx
+	if q := config.QueueConfig(); !q.WaitCountsTowardsTimeout {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, q.Timeout)
+		defer cancel()
+	}
+
+	select {
+	case <-j.ready:
+		return s.releaseFunc(lang), nil
+	case <-waitCtx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		select {
+		case <-j.ready:
+			// slot was granted meanwhile, hand it over to the next job
+			s.queueFor(lang).running--
+			s.dispatch(lang)
+		default:
+			heap.Remove(&q.jobs, j.index)
+			s.queued--
+			stats.queued--
+			stats.expired++
+		}
+		if ctx.Err() == context.Canceled {
+			return nil, errors.E(errors.Errorf("canceled waiting for a free slot"), errors.Canceled, op)
+		}
+		return nil, errors.E(errors.Errorf("timed out waiting for a free slot"), errors.EvalTimeout, op)
+	}
+}
+
+func (s *Scheduler) releaseFunc(lang string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			s.queueFor(lang).running--
+			s.dispatch(lang)
+			s.mu.Unlock()
+		})
+	}
+}
+
+// dispatch hands free slots of lang to queued jobs in order of their finish tags, s.mu must be held.
+func (s *Scheduler) dispatch(lang string) {
+	q := s.queueFor(lang)
+	for q.running < s.slots(lang) && q.jobs.Len() > 0 {
+		j := q.pop()
+		q.running++
+		s.queued--
+
+		stats := s.statsFor(j.flow.class)
+		stats.queued--
+		stats.dispatched++
+		wait := time.Since(j.enqueued)
+		stats.waited += wait
+		stats.waitedJobs++
+		if wait > stats.maxWait {
+			stats.maxWait = wait
+		}
+
+		close(j.ready)
+	}
+}
+
+// slots returns capacity of lang, at least one eval is let through so the evaluator can report errors.
+func (s *Scheduler) slots(lang string) int {
+	if n := s.capacity(lang); n > 0 {
+		return n
+	}
+	return 1
+}
+
+func (s *Scheduler) queueFor(lang string) *queue {
+	q, ok := s.queues[lang]
+	if !ok {
+		q = newQueue()
+		s.queues[lang] = q
+	}
+	return q
+}
+
+func (s *Scheduler) statsFor(class string) *classStats {
+	stats, ok := s.stats[class]
+	if !ok {
+		stats = &classStats{}
+		s.stats[class] = stats
+	}
+	return stats
+}
+
+// ClassStats are queueing statistics of a priority class.
+type ClassStats struct {
+	Queued     int `json:"queued"`
+	Dispatched int `json:"dispatched"`
+	Rejected   int `json:"rejected"`
+	// Expired counts evals which timed out while queued.
+	Expired int `json:"expired"`
+	// MeanWait and MaxWait are in seconds and only cover evals which had to queue.
+	MeanWait float64 `json:"meanWait"`
+	MaxWait  float64 `json:"maxWait"`
+}
+
+type classStats struct {
+	queued     int
+	dispatched int
+	rejected   int
+	expired    int
+	waited     time.Duration
+	waitedJobs int
+	maxWait    time.Duration
+}
+
+// Stats returns queueing statistics of every configured priority class.
+func (s *Scheduler) Stats() map[string]ClassStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make(map[string]ClassStats)
+	for class := range config.SchedulerClasses() {
+		stats := s.statsFor(class)
+		res[class] = ClassStats{
+			Queued:     stats.queued,
+			Dispatched: stats.dispatched,
+			Rejected:   stats.rejected,
+			Expired:    stats.expired,
+			MeanWait:   meanSeconds(stats.waited, stats.waitedJobs),
+			MaxWait:    stats.maxWait.Seconds(),
+		}
+	}
+	return res
+}
+
+func meanSeconds(total time.Duration, n int) float64 {
+	if n == 0 {
+		return 0
+	}
+	return total.Seconds() / float64(n)
+}
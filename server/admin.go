@@ -0,0 +1,260 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hichuyamichu/myriag/config"
+	"github.com/hichuyamichu/myriag/docker"
+	"github.com/hichuyamichu/myriag/errors"
+	"github.com/labstack/echo/v4"
+)
+
+// adminTimeout bounds admin operations which build images or start containers.
+const adminTimeout = 10 * time.Minute
+
+// registerAdmin adds endpoints managing languages and containers at runtime.
+func (s *Server) registerAdmin(token string) {
+	auth := requireToken(token)
+	s.router.POST("/languages/:lang/build", s.buildLanguage, auth)
+	s.router.POST("/languages/:lang/warm", s.warmLanguage, auth)
+	s.router.POST("/languages/:lang/drain", s.drainLanguage, auth)
+	s.router.POST("/languages/:lang/enable", s.enableLanguage, auth)
+	s.router.POST("/languages/:lang/disable", s.disableLanguage, auth)
+	s.router.GET("/languages/:lang/limits", s.languageLimits, auth)
+	s.router.POST("/languages/:lang/limits", s.updateLanguageLimits, auth)
+	s.router.DELETE("/containers/:name", s.killContainer, auth)
+}
+
+// enabledLanguage returns the lang path param if it names an enabled language.
+func enabledLanguage(c echo.Context) (string, error) {
+	const op errors.Op = "server/enabledLanguage"
+
+	lang := strings.ToLower(c.Param("lang"))
+	if !config.IsLangSupported(lang) {
+		return "", errors.E(errors.LanguageNotFound, op)
+	}
+	return lang, nil
+}
+
+type buildResult struct {
+	Language string `json:"language"`
+	Image    string `json:"image"`
+	Version  string `json:"version"`
+}
+
+func (s *Server) buildLanguage(c echo.Context) error {
+	const op errors.Op = "server/Server.buildLanguage"
+
+	type buildPayload struct {
+		Force   bool `json:"force"`
+		NoCache bool `json:"noCache"`
+		Pull    bool `json:"pull"`
+	}
+
+	lang, err := enabledLanguage(c)
+	if err != nil {
+		return errors.E(err, op)
+	}
+
+	p := &buildPayload{}
+	if err := c.Bind(p); err != nil {
+		return errors.E(err, errors.Invalid, op)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), adminTimeout)
+	defer cancel()
+	res, err := s.build(ctx, lang, docker.BuildOptions{Force: p.Force, NoCache: p.NoCache, Pull: p.Pull})
+	if err != nil {
+		return errors.E(err, op)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (s *Server) build(ctx context.Context, lang string, opts docker.BuildOptions) (*buildResult, error) {
+	const op errors.Op = "server/Server.build"
+
+	if err := s.docker.Build(ctx, []string{lang}, opts); err != nil {
+		return nil, errors.E(err, op)
+	}
+
+	statuses, err := s.docker.LanguageStatuses(ctx, []string{lang})
+	if err != nil {
+		return nil, errors.E(err, op)
+	}
+
+	status := statuses[lang]
+	return &buildResult{Language: lang, Image: status.Image, Version: status.Version}, nil
+}
+
+func (s *Server) warmLanguage(c echo.Context) error {
+	const op errors.Op = "server/Server.warmLanguage"
+
+	type warmPayload struct {
+		Count int `json:"count" validate:"required,min=1"`
+	}
+
+	lang, err := enabledLanguage(c)
+	if err != nil {
+		return errors.E(err, op)
+	}
+
+	p := &warmPayload{}
+	if err := c.Bind(p); err != nil {
+		return errors.E(err, errors.Invalid, op)
+	}
+
+	if err := c.Validate(p); err != nil {
+		return errors.E(err, op)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), adminTimeout)
+	defer cancel()
+	containers, err := s.docker.WarmContainers(ctx, lang, p.Count)
+	if err != nil {
+		return errors.E(err, op)
+	}
+
+	type warmResult struct {
+		Language   string   `json:"language"`
+		Containers []string `json:"containers"`
+	}
+
+	return c.JSON(http.StatusOK, &warmResult{Language: lang, Containers: containers})
+}
+
+type drainResult struct {
+	Language string   `json:"language"`
+	Drained  []string `json:"drained"`
+}
+
+func (s *Server) drainLanguage(c echo.Context) error {
+	const op errors.Op = "server/Server.drainLanguage"
+
+	lang, err := enabledLanguage(c)
+	if err != nil {
+		return errors.E(err, op)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), adminTimeout)
+	defer cancel()
+	drained, err := s.docker.Drain(ctx, lang)
+	if err != nil {
+		return errors.E(err, op)
+	}
+
+	return c.JSON(http.StatusOK, &drainResult{Language: lang, Drained: drained})
+}
+
+type enableResult struct {
+	Language string       `json:"language"`
+	Enabled  bool         `json:"enabled"`
+	Build    *buildResult `json:"build,omitempty"`
+	Drained  []string     `json:"drained,omitempty"`
+}
+
+func (s *Server) enableLanguage(c echo.Context) error {
+	const op errors.Op = "server/Server.enableLanguage"
+
+	lang := strings.ToLower(c.Param("lang"))
+	if config.IsLangSupported(lang) {
+		return c.JSON(http.StatusOK, &enableResult{Language: lang, Enabled: true})
+	}
+
+	if err := config.SetEnabled(lang, true); err != nil {
+		return errors.E(err, errors.Invalid, op)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), adminTimeout)
+	defer cancel()
+	res, err := s.build(ctx, lang, docker.BuildOptions{})
+	if err != nil {
+		if err := config.SetEnabled(lang, false); err != nil {
+			c.Logger().Error(err.Error())
+		}
+		return errors.E(err, op)
+	}
+
+	return c.JSON(http.StatusOK, &enableResult{Language: lang, Enabled: true, Build: res})
+}
+
+func (s *Server) disableLanguage(c echo.Context) error {
+	const op errors.Op = "server/Server.disableLanguage"
+
+	lang, err := enabledLanguage(c)
+	if err != nil {
+		return errors.E(err, op)
+	}
+
+	if err := config.SetEnabled(lang, false); err != nil {
+		return errors.E(err, errors.Invalid, op)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), adminTimeout)
+	defer cancel()
+	drained, err := s.docker.Drain(ctx, lang)
+	if err != nil {
+		return errors.E(err, op)
+	}
+
+	return c.JSON(http.StatusOK, &enableResult{Language: lang, Enabled: false, Drained: drained})
+}
+
+type limitsResult struct {
+	Language string        `json:"language"`
+	Limits   config.Limits `json:"limits"`
+	// LastUpdate is nil until limits of the language change
+	LastUpdate *docker.UpdateReport `json:"lastUpdate"`
+}
+
+func (s *Server) languageLimits(c echo.Context) error {
+	const op errors.Op = "server/Server.languageLimits"
+
+	lang, err := enabledLanguage(c)
+	if err != nil {
+		return errors.E(err, op)
+	}
+
+	res := &limitsResult{Language: lang, Limits: config.LimitsFor(lang)}
+	if report, ok := s.docker.LastUpdate(lang); ok {
+		res.LastUpdate = &report
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// updateLanguageLimits applies the configured limits of a language to its running containers again,
+// retrying containers which failed to update on the last reload.
+func (s *Server) updateLanguageLimits(c echo.Context) error {
+	const op errors.Op = "server/Server.updateLanguageLimits"
+
+	lang, err := enabledLanguage(c)
+	if err != nil {
+		return errors.E(err, op)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), adminTimeout)
+	defer cancel()
+	s.docker.ResizeQueues(lang)
+	report, err := s.docker.UpdateLimits(ctx, lang)
+	if err != nil {
+		return errors.E(err, op)
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+func (s *Server) killContainer(c echo.Context) error {
+	const op errors.Op = "server/Server.killContainer"
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	cont, err := s.docker.KillContainer(ctx, c.Param("name"))
+	if err != nil {
+		return errors.E(err, op)
+	}
+
+	return c.JSON(http.StatusOK, cont)
+}
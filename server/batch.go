@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/hichuyamichu/myriag/config"
+	"github.com/hichuyamichu/myriag/errors"
+	"github.com/hichuyamichu/myriag/eval"
+	"github.com/labstack/echo/v4"
+)
+
+// itemResult is the outcome of a single evaluation within a multi eval request.
+type itemResult struct {
+	Language string `json:"language,omitempty"`
+	Status   int    `json:"status"`
+	Result   string `json:"result"`
+	Attempts int    `json:"attempts,omitempty"`
+	// Truncated and OutputBytes are set when the output limit was exceeded
+	Truncated   bool        `json:"truncated,omitempty"`
+	OutputBytes int64       `json:"outputBytes,omitempty"`
+	Usage       *eval.Usage `json:"usage,omitempty"`
+	Verdict     string      `json:"verdict,omitempty"`
+	Error       string      `json:"error,omitempty"`
+}
+
+func newItemResult(lang string, res eval.Result, err error) itemResult {
+	if err != nil {
+		code, message := errorResponse(err)
+		return itemResult{Language: lang, Status: code, Attempts: res.Attempts, Error: fmt.Sprint(message)}
+	}
+	item := itemResult{Language: lang, Status: http.StatusOK, Result: res.Output, Attempts: res.Attempts, Usage: &res.Usage, Verdict: res.Verdict}
+	if res.Truncated {
+		item.Truncated = true
+		item.OutputBytes = res.OutputBytes
+	}
+	return item
+}
+
+func (s *Server) evalBatch(c echo.Context) error {
+	const op errors.Op = "server/Server.evalBatch"
+
+	type batchItem struct {
+		Language string `json:"language" validate:"required"`
+		Code     string `json:"code" validate:"required"`
+	}
+
+	type batchPayload struct {
+		Items []batchItem `json:"items" validate:"required,min=1,dive"`
+	}
+
+	items := make([]batchItem, 0)
+	if err := c.Bind(&items); err != nil {
+		return errors.E(err, errors.Invalid, op)
+	}
+
+	p := &batchPayload{Items: items}
+	if err := c.Validate(p); err != nil {
+		return errors.E(err, errors.Invalid, op)
+	}
+
+	if len(p.Items) > config.MaxBatchItems() {
+		return errors.E(errors.Errorf("batch exceeds %d items", config.MaxBatchItems()), errors.Invalid, op)
+	}
+
+	from := s.originOf(c, config.SchedulerConfig().BatchClass)
+	res := make([]itemResult, len(p.Items))
+	wg := &sync.WaitGroup{}
+	for i, item := range p.Items {
+		wg.Add(1)
+		go func(i int, item batchItem) {
+			defer wg.Done()
+
+			lang, code, err := s.prepare(item.Language, item.Code)
+			if err != nil {
+				res[i] = newItemResult(item.Language, eval.Result{}, err)
+				return
+			}
+
+			ctx := c.Request().Context()
+			if err := s.batchSlots.acquire(ctx); err != nil {
+				res[i] = newItemResult(lang, eval.Result{}, errors.Done(ctx, op))
+				return
+			}
+			out, err := s.run(ctx, from, lang, code)
+			s.batchSlots.release()
+			res[i] = newItemResult(lang, out, err)
+		}(i, item)
+	}
+	wg.Wait()
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// batchSlots is a semaphore whose limit follows batch.concurrent as the config is reloaded.
+// A raised limit lets waiters in once a slot is released.
+type batchSlots struct {
+	mu      sync.Mutex
+	inUse   int
+	waiters []chan struct{}
+}
+
+// acquire blocks until a slot is free or ctx is done.
+func (b *batchSlots) acquire(ctx context.Context) error {
+	b.mu.Lock()
+	if b.inUse < config.MaxBatchConcurrency() && len(b.waiters) == 0 {
+		b.inUse++
+		b.mu.Unlock()
+		return nil
+	}
+
+	ready := make(chan struct{})
+	b.waiters = append(b.waiters, ready)
+	b.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		select {
+		case <-ready:
+			// slot was granted meanwhile, hand it over to the next waiter
+			b.inUse--
+			b.notify()
+		default:
+			for i, w := range b.waiters {
+				if w == ready {
+					b.waiters = append(b.waiters[:i], b.waiters[i+1:]...)
+					break
+				}
+			}
+		}
+		return ctx.Err()
+	}
+}
+
+func (b *batchSlots) release() {
+	b.mu.Lock()
+	b.inUse--
+	b.notify()
+	b.mu.Unlock()
+}
+
+// notify grants free slots to waiters in order, b.mu must be held.
+func (b *batchSlots) notify() {
+	for b.inUse < config.MaxBatchConcurrency() && len(b.waiters) > 0 {
+		b.inUse++
+		close(b.waiters[0])
+		b.waiters = b.waiters[1:]
+	}
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/hichuyamichu/myriag/cluster"
+	"github.com/hichuyamichu/myriag/errors"
+	"github.com/labstack/echo/v4"
+)
+
+// requireToken rejects requests without matching bearer token. Empty token disables the check.
+func requireToken(token string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			const op errors.Op = "server/requireToken"
+
+			if token == "" {
+				return next(c)
+			}
+
+			auth := c.Request().Header.Get(echo.HeaderAuthorization)
+			provided := strings.TrimPrefix(auth, "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				return errors.E(errors.Unauthorized, op)
+			}
+			return next(c)
+		}
+	}
+}
+
+func (s *Server) workers(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.coordinator.Workers())
+}
+
+func (s *Server) registerWorker(c echo.Context) error {
+	const op errors.Op = "server/Server.registerWorker"
+
+	p := &cluster.Registration{}
+	if err := c.Bind(p); err != nil {
+		return errors.E(err, errors.Invalid, op)
+	}
+
+	if err := c.Validate(p); err != nil {
+		return errors.E(err, errors.Invalid, op)
+	}
+
+	s.coordinator.Register(*p)
+	return c.NoContent(http.StatusOK)
+}
@@ -1,8 +1,11 @@
 package server
 
 import (
+	"math"
 	"net/http"
+	"strconv"
 
+	"github.com/hichuyamichu/myriag/config"
 	"github.com/hichuyamichu/myriag/errors"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
@@ -12,18 +15,10 @@ func newErrorHandler(logger *zap.Logger) func(err error, c echo.Context) {
 	return func(err error, c echo.Context) {
 		logger.Error(err.Error())
 
-		var code int
-		var message interface{}
-		switch e := err.(type) {
-		case *errors.Error:
-			code = e.Kind.HTTPStatus()
-			message = e.Kind.String()
-		case *echo.HTTPError:
-			code = e.Code
-			message = e.Message
-		default:
-			code = http.StatusInternalServerError
-			message = http.StatusText(http.StatusInternalServerError)
+		code, message := errorResponse(err)
+		if code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable {
+			retryAfter := int(math.Ceil(config.QueueConfig().RetryAfter.Seconds()))
+			c.Response().Header().Set("Retry-After", strconv.Itoa(retryAfter))
 		}
 
 		if !c.Response().Committed {
@@ -38,3 +33,15 @@ func newErrorHandler(logger *zap.Logger) func(err error, c echo.Context) {
 		}
 	}
 }
+
+// errorResponse maps err to HTTP status code and message safe to show to clients.
+func errorResponse(err error) (int, interface{}) {
+	switch e := err.(type) {
+	case *errors.Error:
+		return e.Kind.HTTPStatus(), e.Kind.String()
+	case *echo.HTTPError:
+		return e.Code, e.Message
+	default:
+		return http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)
+	}
+}
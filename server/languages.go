@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/hichuyamichu/myriag/config"
+	"github.com/hichuyamichu/myriag/docker"
+	"github.com/hichuyamichu/myriag/errors"
+	"github.com/labstack/echo/v4"
+)
+
+// languageInfo combines language manifest with effective limits and runtime state.
+type languageInfo struct {
+	Language string `json:"language"`
+	*config.Manifest
+	// Aliases and Limits shadow the manifest with the effective values.
+	Aliases []string               `json:"aliases"`
+	Limits  config.Limits          `json:"limits"`
+	Status  *docker.LanguageStatus `json:"status,omitempty"`
+}
+
+func (s *Server) languages(c echo.Context) error {
+	const op errors.Op = "server/Server.languages"
+
+	langs := s.evaluator.Languages()
+	if c.QueryParam("expand") != "true" {
+		return c.JSON(http.StatusOK, langs)
+	}
+
+	res, err := s.languageInfos(langs)
+	if err != nil {
+		return errors.E(err, op)
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func (s *Server) language(c echo.Context) error {
+	const op errors.Op = "server/Server.language"
+
+	lang, ok := s.resolve(c.Param("lang"))
+	if !ok {
+		return errors.E(errors.LanguageNotFound, op)
+	}
+
+	res, err := s.languageInfos([]string{lang})
+	if err != nil {
+		return errors.E(err, op)
+	}
+	return c.JSON(http.StatusOK, res[0])
+}
+
+func (s *Server) languageInfos(langs []string) ([]languageInfo, error) {
+	const op errors.Op = "server/Server.languageInfos"
+
+	var statuses map[string]docker.LanguageStatus
+	if s.docker != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+
+		var err error
+		statuses, err = s.docker.LanguageStatuses(ctx, langs)
+		if err != nil {
+			return nil, errors.E(err, op)
+		}
+	}
+
+	res := make([]languageInfo, 0, len(langs))
+	for _, lang := range langs {
+		info := languageInfo{
+			Language: lang,
+			Manifest: config.ManifestFor(lang),
+			Aliases:  config.AliasesFor(lang),
+			Limits:   config.LimitsFor(lang),
+		}
+		if status, ok := statuses[lang]; ok {
+			info.Status = &status
+		}
+		res = append(res, info)
+	}
+	return res, nil
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/hichuyamichu/myriag/config"
+	"github.com/hichuyamichu/myriag/errors"
+	"github.com/hichuyamichu/myriag/eval"
+	"github.com/hichuyamichu/myriag/markdown"
+	"github.com/labstack/echo/v4"
+)
+
+type blockResult struct {
+	Info string `json:"info"`
+	itemResult
+}
+
+func (s *Server) evalMarkdown(c echo.Context) error {
+	const op errors.Op = "server/Server.evalMarkdown"
+
+	type markdownPayload struct {
+		Text string `json:"text" validate:"required"`
+	}
+
+	p := &markdownPayload{}
+	if err := c.Bind(p); err != nil {
+		return errors.E(err, errors.Invalid, op)
+	}
+
+	if err := c.Validate(p); err != nil {
+		return errors.E(err, errors.Invalid, op)
+	}
+
+	blocks := markdown.Blocks(p.Text)
+	res := make([]blockResult, len(blocks))
+	maxBlocks := config.MaxMarkdownBlocks()
+
+	from := s.originOf(c, config.SchedulerConfig().DefaultClass)
+	wg := &sync.WaitGroup{}
+	for i, block := range blocks {
+		res[i].Info = block.Info
+		if i >= maxBlocks {
+			res[i].Status = http.StatusTooManyRequests
+			res[i].Error = fmt.Sprintf("only %d blocks are evaluated per message", maxBlocks)
+			continue
+		}
+
+		lang, ok := s.resolve(block.Info)
+		if !ok {
+			res[i].itemResult = newItemResult("", eval.Result{}, errors.E(errors.LanguageNotFound, op))
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, lang, code string) {
+			out, err := s.run(c.Request().Context(), from, lang, code)
+			res[i].itemResult = newItemResult(lang, out, err)
+			wg.Done()
+		}(i, lang, block.Code)
+	}
+	wg.Wait()
+
+	return c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/hichuyamichu/myriag/cluster"
+	"github.com/hichuyamichu/myriag/config"
+	"github.com/labstack/echo/v4"
+)
+
+// origin identifies who an eval runs for, evals are scheduled fairly across origins.
+type origin struct {
+	client string
+	class  string
+}
+
+// originOf identifies the client of the request. Class defaults to class unless the
+// X-Priority-Class header asks for one weighing no more than it. Evals forwarded by the
+// coordinator keep the origin it identified.
+func (s *Server) originOf(c echo.Context, class string) origin {
+	if s.trustOrigin {
+		if client := c.Request().Header.Get(cluster.ClientHeader); client != "" {
+			// classes of the worker may be configured differently
+			if forwarded := c.Request().Header.Get(cluster.ClassHeader); config.SchedulerClasses()[forwarded] > 0 {
+				class = forwarded
+			}
+			return origin{client: client, class: class}
+		}
+	}
+
+	if requested := c.Request().Header.Get("X-Priority-Class"); requested != "" {
+		class = lowerClass(class, strings.ToLower(requested))
+	}
+
+	cfg := config.SchedulerConfig()
+	if cfg.ClientHeader != "" {
+		if client := c.Request().Header.Get(cfg.ClientHeader); client != "" {
+			return origin{client: client, class: class}
+		}
+	}
+	if auth := c.Request().Header.Get(echo.HeaderAuthorization); auth != "" {
+		return origin{client: auth, class: class}
+	}
+	return origin{client: c.RealIP(), class: class}
+}
+
+// lowerClass returns requested unless it weighs more than class, clients may give way to others
+// but not jump ahead of them. Unknown classes are returned so the scheduler rejects them.
+func lowerClass(class, requested string) string {
+	classes := config.SchedulerClasses()
+	weight, ok := classes[requested]
+	if ok && weight > classes[class] {
+		return class
+	}
+	return requested
+}
+
+// capacityOf returns the number of evals of a language the evaluator runs at once.
+func capacityOf(evaluator Evaluator) func(lang string) int {
+	if e, ok := evaluator.(interface{ Capacity(lang string) int }); ok {
+		return e.Capacity
+	}
+	return config.MaxConcurrentEvlasFor
+}
+
+func (s *Server) schedulerStats(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.scheduler.Stats())
+}
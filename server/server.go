@@ -3,22 +3,48 @@ package server
 import (
 	"context"
 	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/hichuyamichu/myriag/cluster"
 	"github.com/hichuyamichu/myriag/config"
+	"github.com/hichuyamichu/myriag/detect"
 	"github.com/hichuyamichu/myriag/docker"
 	"github.com/hichuyamichu/myriag/errors"
+	"github.com/hichuyamichu/myriag/eval"
+	"github.com/hichuyamichu/myriag/scheduler"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"go.uber.org/zap"
 )
 
+// Evaluator runs evaluations for the http endpoints.
+type Evaluator interface {
+	Languages() []string
+	Eval(ctx context.Context, lang string, code string) (eval.Result, error)
+}
+
 type Server struct {
-	router *echo.Echo
+	router    *echo.Echo
+	evaluator Evaluator
+	// docker is set when evaluations run on local docker hosts
 	docker *docker.Docker
+	// coordinator is set when evaluations are routed to workers
+	coordinator *cluster.Coordinator
+	// batchSlots limits batched evals running at once across all batch requests,
+	// per language limits are enforced by the evaluator
+	batchSlots *batchSlots
+	// scheduler shares slots of every language fairly between clients
+	scheduler *scheduler.Scheduler
+	// stopping is set once shutdown starts, new evals are rejected afterwards
+	stopping int32
+	// trustOrigin is set when every request is authenticated with the cluster token,
+	// the origin forwarded by the coordinator is used then
+	trustOrigin bool
 }
 
-func New(docker *docker.Docker, logger *zap.Logger) *Server {
+func New(evaluator Evaluator, logger *zap.Logger) *Server {
 	r := echo.New()
 	r.HideBanner = true
 	r.HidePort = true
@@ -27,37 +53,84 @@ func New(docker *docker.Docker, logger *zap.Logger) *Server {
 	r.Use(middleware.Recover())
 
 	s := &Server{
-		router: r,
-		docker: docker,
+		router:     r,
+		evaluator:  evaluator,
+		batchSlots: &batchSlots{},
+		scheduler:  scheduler.New(capacityOf(evaluator), logger),
 	}
 
 	s.router.GET("/languages", s.languages)
-	s.router.GET("/containers", s.containers)
-	s.router.POST("/eval", s.eval)
-	s.router.POST("/cleanup", s.cleanup)
+	s.router.GET("/languages/:lang", s.language)
+	s.router.POST("/eval", s.eval, s.rejectWhenStopping)
+	s.router.POST("/eval/markdown", s.evalMarkdown, s.rejectWhenStopping)
+	s.router.POST("/eval/batch", s.evalBatch, s.rejectWhenStopping)
+	s.router.GET("/scheduler", s.schedulerStats)
+
+	switch e := evaluator.(type) {
+	case *docker.Docker:
+		s.docker = e
+		// killing and listing containers is left open only when there are no admin endpoints to guard
+		token := config.AdminToken()
+		s.router.GET("/containers", s.containers, requireToken(token))
+		s.router.POST("/cleanup", s.cleanup, requireToken(token))
+		if token != "" {
+			s.registerAdmin(token)
+		}
+	case *cluster.Coordinator:
+		s.coordinator = e
+		s.router.GET("/workers", s.workers, requireToken(config.ClusterToken()))
+		s.router.POST("/workers", s.registerWorker, requireToken(config.ClusterToken()))
+	}
 
 	return s
 }
 
-func (s *Server) Shutdown(ctx context.Context) {
-	_ = s.router.Shutdown(ctx)
+// RequireToken protects every endpoint with the bearer token.
+func (s *Server) RequireToken(token string) {
+	s.router.Use(requireToken(token))
+	s.trustOrigin = token != ""
 }
 
-func (s *Server) Start(addr string) error {
-	return s.router.Start(addr)
+// StopAccepting makes the server reject new evals while requests in flight keep running.
+func (s *Server) StopAccepting() {
+	atomic.StoreInt32(&s.stopping, 1)
+}
+
+func (s *Server) rejectWhenStopping(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		const op errors.Op = "server/Server.rejectWhenStopping"
+
+		if atomic.LoadInt32(&s.stopping) == 1 {
+			return errors.E(errors.Errorf("server is shutting down"), errors.Unavailable, op)
+		}
+		return next(c)
+	}
 }
 
-func (s *Server) languages(c echo.Context) error {
-	langs := config.Languages()
-	return c.JSON(http.StatusOK, langs)
+// Shutdown stops the server waiting for requests in flight until ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.router.Shutdown(ctx)
+}
+
+func (s *Server) Start(addr string) error {
+	return s.router.Start(addr)
 }
 
 func (s *Server) containers(c echo.Context) error {
 	const op errors.Op = "server/Server.containers"
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	ctx, cancel := context.WithTimeout(c.Request().Context(), time.Second*10)
 	defer cancel()
-	containers, err := s.docker.ListContainers(ctx)
+	opts := docker.ListOptions{
+		Language: c.QueryParam("language"),
+		Stats:    c.QueryParam("stats") == "true",
+	}
+	// containers of disabled languages are listed until drained, so unknown names are used as they are
+	if lang, ok := config.ResolveLanguage(opts.Language); ok {
+		opts.Language = lang
+	}
+
+	containers, err := s.docker.ListContainers(ctx, opts)
 	if err != nil {
 		return errors.E(err, op)
 	}
@@ -82,35 +155,131 @@ func (s *Server) eval(c echo.Context) error {
 		return errors.E(err, op)
 	}
 
-	timeout := config.TimeoutFor(p.Language)
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+	lang, code, err := s.prepare(p.Language, p.Code)
+	if err != nil {
+		return errors.E(err, op)
+	}
 
-	retry := 0
-	maxRetry := config.RetryCountFor(p.Language)
-try:
-	res, err := s.docker.Eval(ctx, p.Language, p.Code)
+	res, err := s.run(c.Request().Context(), s.originOf(c, config.SchedulerConfig().DefaultClass), lang, code)
 	if err != nil {
-		if !errors.Is(err, errors.EvalTimeout) && retry <= maxRetry {
-			retry++
-			goto try
-		}
 		return errors.E(err, op)
 	}
 
 	type evalResponce struct {
-		Result string `json:"result"`
+		Language    string     `json:"language"`
+		Result      string     `json:"result"`
+		Attempts    int        `json:"attempts"`
+		Truncated   bool       `json:"truncated"`
+		OutputBytes int64      `json:"outputBytes"`
+		Usage       eval.Usage `json:"usage"`
+		Verdict     string     `json:"verdict"`
+	}
+
+	return c.JSON(http.StatusOK, &evalResponce{
+		Language:    lang,
+		Result:      res.Output,
+		Attempts:    res.Attempts,
+		Truncated:   res.Truncated,
+		OutputBytes: res.OutputBytes,
+		Usage:       res.Usage,
+		Verdict:     res.Verdict,
+	})
+}
+
+// prepare resolves requested language, detecting it when asked to.
+func (s *Server) prepare(lang, code string) (string, string, error) {
+	const op errors.Op = "server/Server.prepare"
+
+	if strings.ToLower(lang) == detect.Auto {
+		detected, body, ok := detect.Language(code)
+		if !ok {
+			return "", "", errors.E(errors.Errorf("failed to detect language"), errors.Invalid, op)
+		}
+		return detected, body, nil
+	}
+
+	resolved, ok := s.resolve(lang)
+	if !ok {
+		return "", "", errors.E(errors.LanguageNotFound, op)
+	}
+	return resolved, code, nil
+}
+
+// resolve maps a language name or alias to a language served by the evaluator.
+func (s *Server) resolve(name string) (string, bool) {
+	if lang, ok := config.ResolveLanguage(name); ok {
+		return lang, true
+	}
+	if s.serves(name) {
+		return name, true
+	}
+	return "", false
+}
+
+// serves reports whether lang is served by the evaluator.
+func (s *Server) serves(lang string) bool {
+	for _, l := range s.evaluator.Languages() {
+		if l == lang {
+			return true
+		}
+	}
+	return false
+}
+
+// run waits for a slot of lang and evaluates code, retries are up to the evaluator.
+// The eval is stopped once ctx is done, which is when the client disconnects.
+func (s *Server) run(ctx context.Context, from origin, lang, code string) (eval.Result, error) {
+	const op errors.Op = "server/Server.run"
+
+	// the scheduler keeps a queue for every language it is asked for
+	if !s.serves(lang) {
+		return eval.Result{}, errors.E(errors.LanguageNotFound, op)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.EvalDeadlineFor(lang))
+	defer cancel()
+
+	release, err := s.scheduler.Acquire(ctx, lang, from.client, from.class)
+	if err != nil {
+		return eval.Result{}, errors.E(err, op)
+	}
+	defer release()
+
+	res, err := s.evaluator.Eval(cluster.WithOrigin(ctx, from.client, from.class), lang, code)
+	if err != nil {
+		return res, errors.E(err, op)
 	}
 
-	return c.JSON(http.StatusOK, &evalResponce{Result: res})
+	return res, nil
 }
 
 func (s *Server) cleanup(c echo.Context) error {
 	const op errors.Op = "server/Server.cleanup"
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	type cleanupPayload struct {
+		Language string `json:"language"`
+		// IdleFor is in seconds
+		IdleFor int `json:"idleFor" validate:"min=0"`
+	}
+
+	p := &cleanupPayload{}
+	if err := c.Bind(p); err != nil {
+		return errors.E(err, errors.Invalid, op)
+	}
+
+	if err := c.Validate(p); err != nil {
+		return errors.E(err, op)
+	}
+
+	opts := docker.CleanupOptions{Language: p.Language, IdleFor: time.Second * time.Duration(p.IdleFor)}
+	if lang, ok := config.ResolveLanguage(opts.Language); ok {
+		opts.Language = lang
+	}
+
+	// containers are given up to their language timeout to finish in-flight evals
+	ctx, cancel := context.WithTimeout(c.Request().Context(), time.Minute)
 	defer cancel()
-	containers, err := s.docker.Cleanup(ctx)
+	containers, err := s.docker.Cleanup(ctx, opts)
 	if err != nil {
 		return errors.E(err, op)
 	}